@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/config"
+	"github.com/Kcrong/autostudy/pkg/driver"
+	"github.com/Kcrong/autostudy/pkg/noti"
+	"github.com/Kcrong/autostudy/pkg/univ"
+)
+
+type app struct {
+	c          config.Config
+	bot        *noti.TelegramBot
+	pool       *driver.Pool
+	auth       *univ.Auth
+	reportFunc func(error, selenium.WebDriver)
+	selector   *selector
+	policy     *runPolicy
+	quarantine *quarantine
+	dialogs    *driver.DialogHandler
+	nowFunc    func() time.Time
+}
+
+// withSession runs f with a logged in browser session of the pool.
+// Errors are reported with the screenshot of the session, and returned for bookkeeping.
+func (a *app) withSession(f func(selenium.WebDriver) error) (err error) {
+	s, err := a.pool.Acquire()
+	if err != nil {
+		a.reportFunc(err, nil)
+		return err
+	}
+	defer func() {
+		a.reportFunc(a.pool.Release(s, err != nil), nil)
+	}()
+
+	// NOTE: Sessions are kept logged in while they are in the pool.
+	if s.Uses() == 0 {
+		if err := a.auth.Authenticate(s); err != nil {
+			a.reportFunc(err, s)
+			return err
+		}
+	}
+
+	if err := f(driver.WithDialogHandler(s, a.dialogs)); err != nil {
+		a.reportFunc(err, s)
+		return err
+	}
+
+	return nil
+}
+
+// runReported runs f with a session for a command. The errors are not returned to the router,
+// since withSession has already reported them with the screenshot of the session.
+func (a *app) runReported(f func(selenium.WebDriver) error) error {
+	_ = a.withSession(f)
+
+	return nil
+}
+
+// lectureFilterFuncType decides whether the lecture should be watched in a run.
+type lectureFilterFuncType func(univ.Lecture) bool
+
+func allLectures(univ.Lecture) bool {
+	return true
+}
+
+func subjectFilter(query string) lectureFilterFuncType {
+	return func(l univ.Lecture) bool {
+		return strings.Contains(strings.ToLower(l.SubjectTitle), strings.ToLower(query))
+	}
+}
+
+func allOf(filters ...lectureFilterFuncType) lectureFilterFuncType {
+	return func(l univ.Lecture) bool {
+		for _, f := range filters {
+			if !f(l) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// watchAll scans the lectures, then watches the ones passing filter with UnivConcurrency sessions.
+// The progress is reported to a single telegram message, and the summary is sent when all sessions are done.
+// Like withSession, errors are already reported, and returned for bookkeeping only.
+func (a *app) watchAll(filter lectureFilterFuncType) error {
+	var plan *univ.Plan
+	if err := a.withSession(func(wd selenium.WebDriver) error {
+		var err error
+		plan, err = univ.Scan(a.c.Url.Lecture, wd, a.auth)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	var targets, quarantined, unsupported []univ.Lecture
+	for _, l := range selectTargets(plan, filter, a.policy) {
+		switch {
+		case !a.content().Supports(l):
+			unsupported = append(unsupported, l)
+		case !a.quarantine.allow(l):
+			quarantined = append(quarantined, l)
+		default:
+			targets = append(targets, l)
+		}
+	}
+
+	progress, err := a.bot.NewProgress(len(targets))
+	if err != nil {
+		a.reportFunc(err, nil)
+		return err
+	}
+
+	summary := a.watchParallel(targets, progress)
+	summary.quarantined = quarantined
+	summary.unsupported = unsupported
+
+	a.reportFunc(progress.Finish(), nil)
+	a.reportFunc(a.bot.SendMessage(summary.String()), nil)
+
+	return summary.err()
+}
+
+// selectTargets returns the lectures a run watches, in the order to watch.
+func selectTargets(plan *univ.Plan, filter lectureFilterFuncType, policy *runPolicy) []univ.Lecture {
+	var targets []univ.Lecture
+	for _, lecture := range plan.Pending() {
+		if filter(lecture) {
+			targets = append(targets, lecture)
+		}
+	}
+	policy.sort(targets)
+
+	return targets
+}
+
+// toPlanReport describes what a run would do, without watching anything.
+func toPlanReport(targets []univ.Lecture, content univ.ContentOption) string {
+	var sb strings.Builder
+	sb.WriteString("실행 계획")
+	sb.WriteString("\n")
+
+	for i, lecture := range targets {
+		msg := fmt.Sprintf("%d. %s - %s", i+1, lecture.SubjectTitle, lecture.Title)
+		if !content.Supports(lecture) {
+			msg += " " + "unsupported: " + lecture.Type.String()
+		} else if lecture.Type != univ.LectureTypeVideo {
+			msg += " " + "type: " + lecture.Type.String()
+		}
+		if !lecture.HasPlayed && lecture.PlaybackDuration > 0 {
+			msg += " " + "playback: " + lecture.RemainingPlayback().String()
+		}
+		if lecture.ShouldBeExamined() {
+			msg += " " + "quiz"
+		}
+		if !lecture.Deadline.IsZero() {
+			msg += " " + "deadline: " + lecture.Deadline.Format("2006-01-02 15:04")
+		}
+		sb.WriteString(msg)
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("Lectures: %d, Estimated time: %s", len(targets), univ.EstimateDuration(targets)))
+
+	return sb.String()
+}
+
+func toNotCompletedReport(subjects []univ.Subject) string {
+	var sb strings.Builder
+	sb.WriteString("미완료 과목 목록")
+	sb.WriteString("\n")
+
+	for _, subject := range subjects {
+		if subject.IsCompleted() {
+			continue
+		}
+
+		sb.WriteString("- ")
+		sb.WriteString(subject.Title + ": " + fmt.Sprintf("%.2f%%", subject.Progress))
+		sb.WriteString("\n")
+
+		for _, lecture := range subject.Lectures {
+			if !lecture.IsReadied {
+				sb.WriteString("-- ")
+				sb.WriteString(lecture.Title + " " + "준비중")
+				sb.WriteString("\n")
+
+				continue
+			}
+
+			if lecture.IsDone() {
+				continue
+			}
+
+			sb.WriteString("-- ")
+			msg := lecture.Title + " " + "playback: " + toCheckbox(lecture.HasPlayed)
+			if lecture.HasExam {
+				msg += " " + "quiz: " + toCheckbox(lecture.HasExamCompleted)
+			}
+			sb.WriteString(msg)
+			sb.WriteString("\n")
+		}
+	}
+
+	return sb.String()
+}
+
+func toCheckbox(v bool) string {
+	if v {
+		return "[v]"
+	}
+
+	return "[-]"
+}
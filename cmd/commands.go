@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/config"
+	"github.com/Kcrong/autostudy/pkg/noti"
+	"github.com/Kcrong/autostudy/pkg/univ"
+)
+
+const (
+	commandRun     = "run"
+	commandRelease = "release"
+
+	runSelectFlag = "--select"
+)
+
+type runArgs struct {
+	subjectQuery   string
+	selectLectures bool
+}
+
+// commands returns every command of the bot. Add a new command here.
+func (a *app) commands() []noti.Command {
+	return []noti.Command{
+		{
+			Name:        "report",
+			Description: "Report lectures not completed yet",
+			Role:        noti.RoleMember,
+			Handler: func(noti.Request) error {
+				return a.runReported(func(wd selenium.WebDriver) error {
+					plan, err := univ.Scan(a.c.Url.Lecture, wd, a.auth)
+					if err != nil {
+						return err
+					}
+
+					return a.bot.SendMessage(toNotCompletedReport(plan.Subjects()))
+				})
+			},
+		},
+		{
+			Name:        commandRun,
+			Description: "Watch lectures not completed yet. Pick them from a keyboard with " + runSelectFlag,
+			Usage:       "[subject | " + runSelectFlag + "]",
+			Role:        noti.RoleOwner,
+			ParseArgs:   parseRunArgs,
+			Handler: func(req noti.Request) error {
+				args := req.Args.(runArgs)
+				if args.selectLectures {
+					return a.runReported(func(wd selenium.WebDriver) error {
+						plan, err := univ.Scan(a.c.Url.Lecture, wd, a.auth)
+						if err != nil {
+							return err
+						}
+
+						return a.sendSubjectKeyboard(plan)
+					})
+				}
+
+				filter := a.policy.allow
+				if args.subjectQuery != "" {
+					filter = allOf(a.policy.allow, subjectFilter(args.subjectQuery))
+				}
+
+				return a.runSelected(filter)
+			},
+			Callback: a.handleSelect,
+		},
+		{
+			Name:        "plan",
+			Description: "Show what a run would watch, without watching anything",
+			Usage:       "[subject]",
+			Role:        noti.RoleMember,
+			ParseArgs:   parseStringArg,
+			Handler: func(req noti.Request) error {
+				filter := a.policy.allow
+				if query := req.Args.(string); query != "" {
+					filter = allOf(a.policy.allow, subjectFilter(query))
+				}
+
+				return a.runReported(func(wd selenium.WebDriver) error {
+					plan, err := univ.Scan(a.c.Url.Lecture, wd, a.auth)
+					if err != nil {
+						return err
+					}
+
+					return a.bot.SendMessage(toPlanReport(selectTargets(plan, filter, a.policy), a.content()))
+				})
+			},
+		},
+		{
+			Name:        "filter",
+			Description: "Show or change the filter rules and the order of the runs",
+			Usage:       "[include|exclude subject|lecture <pattern> | remove <n> | order <policy> | priority <pattern;;...>]",
+			Role:        noti.RoleOwner,
+			ParseArgs:   parseFilterArgs,
+			Handler: func(req noti.Request) error {
+				if err := req.Args.(func(*runPolicy) error)(a.policy); err != nil {
+					return a.bot.SendMessage(err.Error())
+				}
+
+				return a.bot.SendMessage(a.policy.report())
+			},
+		},
+		{
+			Name:        "quarantine",
+			Description: "Show the lectures skipped since they failed too many times",
+			Role:        noti.RoleMember,
+			Handler: func(noti.Request) error {
+				return a.bot.SendMessage(a.quarantine.report())
+			},
+		},
+		{
+			Name:        commandRelease,
+			Description: "Release quarantined lectures, so that the next run watches them",
+			Usage:       "<n | " + releaseAll + ">",
+			Role:        noti.RoleOwner,
+			ParseArgs:   parseReleaseArgs,
+			Handler: func(req noti.Request) error {
+				n, err := a.quarantine.release(req.Args.(string))
+				if err != nil {
+					return a.bot.SendMessage(err.Error() + "\n" + a.quarantine.report())
+				}
+
+				return a.bot.SendMessage(fmt.Sprintf("Released %d lectures", n))
+			},
+		},
+	}
+}
+
+func parseStringArg(args string) (interface{}, error) {
+	return args, nil
+}
+
+func parseReleaseArgs(args string) (interface{}, error) {
+	if args == "" {
+		return nil, errors.New("lecture number is required")
+	}
+
+	return args, nil
+}
+
+func parseRunArgs(args string) (interface{}, error) {
+	if args == runSelectFlag {
+		return runArgs{selectLectures: true}, nil
+	}
+
+	return runArgs{subjectQuery: args}, nil
+}
+
+// parseFilterArgs returns the change to apply to the run policy.
+func parseFilterArgs(args string) (interface{}, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return func(*runPolicy) error { return nil }, nil
+	}
+
+	switch fields[0] {
+	case string(univ.RuleInclude), string(univ.RuleExclude):
+		if len(fields) < 3 {
+			return nil, errors.New("pattern is required")
+		}
+
+		rule, err := univ.NewRule(fields[0], fields[1], strings.Join(fields[2:], " "))
+		if err != nil {
+			return nil, err
+		}
+
+		return func(p *runPolicy) error {
+			p.addRule(rule)
+			return nil
+		}, nil
+	case "remove":
+		if len(fields) != 2 {
+			return nil, errors.New("rule number is required")
+		}
+
+		idx, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, errors.Errorf("invalid rule number: %s", fields[1])
+		}
+
+		return func(p *runPolicy) error {
+			return p.removeRule(idx)
+		}, nil
+	case "order":
+		if len(fields) != 2 {
+			return nil, errors.New("order policy is required")
+		}
+
+		order, err := univ.ParseOrderPolicy(fields[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return func(p *runPolicy) error {
+			p.setOrder(order)
+			return nil
+		}, nil
+	case "priority":
+		// NOTE: Clears the priority if no pattern is given.
+		patterns := config.SplitPatterns(strings.TrimPrefix(args, fields[0]))
+
+		return func(p *runPolicy) error {
+			return p.setPriority(patterns)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown filter command: %s", fields[0])
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kcrong/autostudy/pkg/config"
+	"github.com/Kcrong/autostudy/pkg/driver"
+	"github.com/Kcrong/autostudy/pkg/univ"
+)
+
+// printPlan logs in and prints what a run would watch, without clicking any lecture.
+// It is used to check the config, the selectors and the filters before a scheduled run.
+func printPlan(c config.Config, profile driver.Profile, opt *driver.InitOption, auth *univ.Auth, policy *runPolicy) (err error) {
+	wd, closeFunc, err := driver.Init(c.SeleniumWebDriverHost, profile, opt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := closeFunc(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	if err := auth.Authenticate(wd); err != nil {
+		return err
+	}
+
+	plan, err := univ.Scan(c.Url.Lecture, wd, auth)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(toPlanReport(selectTargets(plan, policy.allow, policy), univ.ContentOption{AnswerSurveys: c.AnswerSurveys}))
+
+	return nil
+}
+
+// askOTPFromStdin asks the one-time code of the login in the terminal, since the bot is not started by a dry run.
+func askOTPFromStdin(prompt string) (string, error) {
+	fmt.Println(prompt)
+	fmt.Print("One-time code: ")
+
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", errors.Wrap(err, "read one-time code")
+	}
+
+	return strings.TrimSpace(code), nil
+}
@@ -1,19 +1,24 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
 	"math/rand"
-	"strings"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	_ "time/tzdata"
 
 	"github.com/getsentry/sentry-go"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/tebeka/selenium"
 
 	"github.com/Kcrong/autostudy/pkg/config"
 	"github.com/Kcrong/autostudy/pkg/driver"
+	"github.com/Kcrong/autostudy/pkg/failure"
 	"github.com/Kcrong/autostudy/pkg/noti"
 	"github.com/Kcrong/autostudy/pkg/univ"
 )
@@ -27,11 +32,28 @@ func NewReportFunc(telegramBot *noti.TelegramBot) func(error, selenium.WebDriver
 		log.Errorf("%+v", err)
 		sentry.CaptureException(err)
 
-		if err := telegramBot.SendMessage("에러가 발생했습니다."); err != nil {
-			sentry.CaptureException(err)
+		// NOTE: The notifier can not notify its own failure.
+		if errors.Is(err, failure.ErrNotifierFailed) {
+			return
 		}
-		if err := telegramBot.SendMessage(err.Error()); err != nil {
-			sentry.CaptureException(err)
+
+		var loginErr *univ.LoginError
+		if errors.As(err, &loginErr) {
+			if err := telegramBot.SendMessage(loginErr.Notification()); err != nil {
+				sentry.CaptureException(err)
+			}
+		} else {
+			if err := telegramBot.SendMessage("에러가 발생했습니다."); err != nil {
+				sentry.CaptureException(err)
+			}
+			if err := telegramBot.SendMessage(err.Error()); err != nil {
+				sentry.CaptureException(err)
+			}
+			if hint := failure.Hint(err); hint != "" {
+				if err := telegramBot.SendMessage("Hint: " + hint); err != nil {
+					sentry.CaptureException(err)
+				}
+			}
 		}
 
 		if wd == nil {
@@ -46,7 +68,30 @@ func NewReportFunc(telegramBot *noti.TelegramBot) func(error, selenium.WebDriver
 	}
 }
 
+func newDialogHandler(c config.DialogConfig) (*driver.DialogHandler, error) {
+	h := &driver.DialogHandler{}
+
+	for _, r := range c.Rules {
+		rule, err := driver.NewDialogRule(r)
+		if err != nil {
+			return nil, err
+		}
+		h.Rules = append(h.Rules, rule)
+	}
+
+	action, err := driver.ParseDialogAction(c.DefaultAction)
+	if err != nil {
+		return nil, err
+	}
+	h.Default = action
+
+	return h, nil
+}
+
 func main() {
+	dryRun := flag.Bool("dry-run", false, "Log in and print what a run would watch, without watching anything")
+	flag.Parse()
+
 	c, err := config.NewConfig()
 	if err != nil {
 		log.Fatalf("%+v", err)
@@ -63,18 +108,6 @@ func main() {
 	// Randomize seed.
 	rand.Seed(nowFunc().Unix())
 
-	if err := noti.InitSentry(c); err != nil {
-		log.Fatalf("%+v", err)
-	}
-	defer sentry.Flush(2 * time.Second)
-
-	bot, err := noti.NewTelegramBot(c.TelegramToken, c.TelegramChatID, nowFunc)
-	if err != nil {
-		log.Fatalf("%+v", err)
-	}
-
-	reportFunc := NewReportFunc(bot)
-
 	var opt *driver.InitOption
 	if c.UseLocalBrowser {
 		opt = &driver.InitOption{
@@ -83,110 +116,157 @@ func main() {
 		}
 	}
 
-	go func() {
-		for range time.Tick(time.Hour * time.Duration(24*rand.Intn(3))) {
-			wd, closeFunc, err := driver.Init(c.SeleniumWebDriverHost, c.ShouldRunHeadless, opt)
-			if err != nil {
-				log.Fatalf("%+v", err)
-			}
-
-			if err := univ.Login(wd, c.Url.Main, c.UnivID, c.UnivPW, &c.Url.MyProfile); err != nil {
-				reportFunc(err, wd)
-			}
-			if _, err := univ.GetSubjects(c.Url.Lecture, wd, true, univ.NewWatchFunc(wd, c.Url.Lecture, bot)); err != nil {
-				reportFunc(err, wd)
-			}
-
-			reportFunc(closeFunc(), nil)
-			sentry.Flush(2 * time.Second)
-		}
-	}()
-
-	for update := range bot.Updates() {
-		if update.Message == nil || !update.Message.IsCommand() || !noti.IsValidCommand(update.Message.Command()) {
-			continue
-		}
+	profile := driver.Profile{
+		Headless:        c.ShouldRunHeadless,
+		Args:            c.Browser.Args,
+		WindowSize:      c.Browser.WindowSize,
+		Language:        c.Browser.Language,
+		UserAgent:       c.Browser.UserAgent,
+		Proxy:           c.Browser.Proxy,
+		DownloadDir:     c.Browser.DownloadDir,
+		UserDataDir:     c.Browser.UserDataDir,
+		PageLoadTimeout: c.Browser.PageLoadTimeout,
+		ScriptTimeout:   c.Browser.ScriptTimeout,
+	}
 
-		wd, closeFunc, err := driver.Init(c.SeleniumWebDriverHost, c.ShouldRunHeadless, opt)
+	// NOTE: Without the secret, the cookies are still shared by the sessions, not to ask the one-time code for each.
+	cookies := univ.NewMemoryCookieStore()
+	if c.CookieSecret != "" {
+		cookies, err = univ.NewCookieStore(c.CookieStorePath, c.CookieSecret)
 		if err != nil {
 			log.Fatalf("%+v", err)
 		}
+	}
 
-		switch update.Message.Command() {
-		case noti.CommandReport:
-			if err := univ.Login(wd, c.Url.Main, c.UnivID, c.UnivPW, &c.Url.MyProfile); err != nil {
-				reportFunc(err, wd)
-			}
-			if subjects, err := univ.GetSubjects(c.Url.Lecture, wd, true, nil); err != nil {
-				reportFunc(err, wd)
-			} else {
-				err := bot.SendMessage(toNotCompletedReport(subjects))
-				if err != nil {
-					reportFunc(err, nil)
-				}
-			}
-		case noti.CommandRun:
-			if err := univ.Login(wd, c.Url.Main, c.UnivID, c.UnivPW, &c.Url.MyProfile); err != nil {
-				reportFunc(err, wd)
-			}
-			if _, err := univ.GetSubjects(c.Url.Lecture, wd, true, univ.NewWatchFunc(wd, c.Url.Lecture, bot)); err != nil {
-				reportFunc(err, wd)
-			}
-			if err := bot.SendMessage("Done"); err != nil {
-				reportFunc(err, nil)
-			}
+	auth := &univ.Auth{
+		Url:        c.Url.Main,
+		ProfileUrl: c.Url.MyProfile,
+		LoginUrl:   c.Url.Login,
+		ID:         c.UnivID,
+		PW:         c.UnivPW,
+		Cookies:    cookies,
+	}
+
+	policy, err := newRunPolicy(c.Filter)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
+
+	dialogs, err := newDialogHandler(c.Dialog)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
 
-			// TODO: case noti.CommandScreenshot, case noti.CommandStop
+	if *dryRun {
+		auth.OTPFunc = askOTPFromStdin
+		if err := printPlan(c, profile, opt, auth, policy); err != nil {
+			log.Fatalf("%+v", err)
 		}
+		return
+	}
 
-		reportFunc(closeFunc(), nil)
+	if err := noti.InitSentry(c); err != nil {
+		log.Fatalf("%+v", err)
+	}
+	defer sentry.Flush(2 * time.Second)
+
+	bot, err := noti.NewTelegramBot(c.TelegramToken, c.TelegramChatID, nowFunc)
+	if err != nil {
+		log.Fatalf("%+v", err)
 	}
-}
 
-func toNotCompletedReport(subjects []*univ.Subject) string {
-	var sb strings.Builder
-	sb.WriteString("미완료 과목 목록")
-	sb.WriteString("\n")
+	registry, err := driver.NewRegistry(c.Session.RegistryPath)
+	if err != nil {
+		log.Fatalf("%+v", err)
+	}
 
-	for _, subject := range subjects {
-		if subject.IsCompleted() {
-			continue
+	pool := driver.NewPool(func() (selenium.WebDriver, func() error, error) {
+		wd, closeFunc, err := driver.Init(c.SeleniumWebDriverHost, profile, opt)
+		if err != nil {
+			return nil, closeFunc, err
 		}
 
-		sb.WriteString("- ")
-		sb.WriteString(subject.Title + ": " + fmt.Sprintf("%.2f%%", subject.Progress))
-		sb.WriteString("\n")
+		closeFunc, err = registry.Track(wd, closeFunc)
+		return wd, closeFunc, err
+	}, driver.PoolOption{
+		MaxSessions:    c.Session.MaxSessions,
+		MaxUses:        c.Session.MaxUses,
+		MaxMemoryBytes: c.Session.MaxMemoryMB * 1024 * 1024,
+		MaxIdleTime:    c.Session.MaxIdleTime,
+	})
+
+	a := &app{
+		c:          c,
+		bot:        bot,
+		pool:       pool,
+		auth:       auth,
+		reportFunc: NewReportFunc(bot),
+		selector:   &selector{},
+		policy:     policy,
+		quarantine: newQuarantine(c.Retry.QuarantineAfter),
+		dialogs:    dialogs,
+		nowFunc:    nowFunc,
+	}
 
-		for _, lecture := range subject.Lectures {
-			if !lecture.IsReadied {
-				sb.WriteString("-- ")
-				sb.WriteString(lecture.Title + " " + "준비중")
-				sb.WriteString("\n")
+	dialogs.NotifyFunc = func(text string) {
+		a.reportFunc(bot.SendMessage("알림창: "+text), nil)
+	}
 
-				continue
+	// NOTE: The sessions left by the previous process are reaped on startup, then periodically.
+	// Local sessions are not reaped, since each of them has its own chromedriver service.
+	if !c.UseLocalBrowser {
+		reaper := driver.NewReaper(c.SeleniumWebDriverHost, registry)
+		go func() {
+			for {
+				if n, err := reaper.Reap(); err != nil {
+					log.Warnf("%+v", err)
+				} else if n > 0 {
+					log.Infof("Reaped %d orphaned sessions", n)
+				}
+				time.Sleep(c.Session.ReapInterval)
 			}
+		}()
+	}
 
-			if lecture.IsDone() {
-				continue
-			}
+	router := noti.NewRouter(bot, c.TelegramOwnerIDs)
+	if err := router.Register(a.commands()...); err != nil {
+		log.Fatalf("%+v", err)
+	}
 
-			sb.WriteString("-- ")
-			msg := lecture.Title + " " + "playback: " + toCheckbox(lecture.HasPlayed)
-			if lecture.HasExam {
-				msg += " " + "quiz: " + toCheckbox(lecture.HasExamCompleted)
-			}
-			sb.WriteString(msg)
-			sb.WriteString("\n")
-		}
+	auth.OTPFunc = func(prompt string) (string, error) {
+		return router.Ask("로그인 인증 코드를 이 메시지에 답장으로 보내주세요.\n"+prompt, c.TelegramOTPTimeout)
 	}
 
-	return sb.String()
-}
+	go func() {
+		for range time.Tick(time.Hour * time.Duration(24*rand.Intn(3))) {
+			_ = a.watchAll(a.policy.allow)
+			sentry.Flush(2 * time.Second)
+		}
+	}()
+
+	var updates tgbotapi.UpdatesChannel
+	if !c.TelegramWebhook.Enabled {
+		updates = bot.Updates()
+	} else {
+		// NOTE: The webhook server stops on a signal, so that the sessions are closed below.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		updates, err = bot.ListenWebhook(ctx, noti.WebhookOption{
+			ListenAddr:  c.TelegramWebhook.ListenAddr,
+			Path:        c.TelegramWebhook.Path,
+			SecretToken: c.TelegramWebhook.SecretToken,
+			PublicURL:   c.TelegramWebhook.PublicURL,
+		})
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+	}
 
-func toCheckbox(v bool) string {
-	if v {
-		return "[v]"
+	// NOTE: The answers to the questions are taken out here, since a command blocks the loop below.
+	for update := range router.Intercept(updates) {
+		a.reportFunc(router.Dispatch(update), nil)
 	}
 
-	return "[-]"
+	a.reportFunc(pool.Close(), nil)
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kcrong/autostudy/pkg/config"
+	"github.com/Kcrong/autostudy/pkg/univ"
+)
+
+// runPolicy is the filter rules and the order of the runs.
+// It starts from the config and can be changed by the filter command.
+type runPolicy struct {
+	mu       sync.Mutex
+	rules    univ.Rules
+	order    univ.OrderPolicy
+	priority []*regexp.Regexp
+}
+
+func newRunPolicy(c config.FilterConfig) (*runPolicy, error) {
+	p := &runPolicy{}
+
+	for _, r := range []struct {
+		action  univ.RuleAction
+		target  univ.RuleTarget
+		pattern string
+	}{
+		{univ.RuleInclude, univ.RuleTargetSubject, c.SubjectInclude},
+		{univ.RuleExclude, univ.RuleTargetSubject, c.SubjectExclude},
+		{univ.RuleInclude, univ.RuleTargetLecture, c.LectureInclude},
+		{univ.RuleExclude, univ.RuleTargetLecture, c.LectureExclude},
+	} {
+		if r.pattern == "" {
+			continue
+		}
+
+		rule, err := univ.NewRule(string(r.action), string(r.target), r.pattern)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, rule)
+	}
+
+	order, err := univ.ParseOrderPolicy(c.Order)
+	if err != nil {
+		return nil, err
+	}
+	p.order = order
+
+	if err := p.setPriority(c.SubjectPriority); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *runPolicy) allow(l univ.Lecture) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.rules.Allow(l)
+}
+
+func (p *runPolicy) sort(lectures []univ.Lecture) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	univ.SortLectures(lectures, p.order, p.priority)
+}
+
+func (p *runPolicy) addRule(rule univ.Rule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rules = append(p.rules, rule)
+}
+
+// removeRule removes the rule at the 1-based index shown by report.
+func (p *runPolicy) removeRule(idx int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if idx < 1 || idx > len(p.rules) {
+		return errors.Errorf("no such rule: %d", idx)
+	}
+
+	p.rules = append(p.rules[:idx-1:idx-1], p.rules[idx:]...)
+
+	return nil
+}
+
+func (p *runPolicy) setOrder(order univ.OrderPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.order = order
+}
+
+func (p *runPolicy) setPriority(patterns []string) error {
+	priority := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return errors.Wrapf(err, "regexp.Compile(%s)", pattern)
+		}
+		priority[i] = re
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.priority = priority
+
+	return nil
+}
+
+func (p *runPolicy) report() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("Rules")
+	if len(p.rules) == 0 {
+		sb.WriteString("\n- none")
+	}
+	for i, rule := range p.rules {
+		sb.WriteString("\n" + strconv.Itoa(i+1) + ". " + rule.String())
+	}
+
+	sb.WriteString("\nOrder: " + string(p.order))
+	if len(p.priority) > 0 {
+		patterns := make([]string, len(p.priority))
+		for i, re := range p.priority {
+			patterns[i] = re.String()
+		}
+		sb.WriteString("\nPriority: " + strings.Join(patterns, ", "))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Kcrong/autostudy/pkg/univ"
+)
+
+const releaseAll = "all"
+
+type quarantinedLecture struct {
+	lecture univ.Lecture
+	err     error
+	at      time.Time
+}
+
+// quarantine counts the runs each lecture failed in, and skips the lectures failed too many times until released.
+type quarantine struct {
+	mu        sync.Mutex
+	threshold int
+	failures  map[univ.LectureID]int
+	lectures  []quarantinedLecture
+}
+
+func newQuarantine(threshold int) *quarantine {
+	return &quarantine{
+		threshold: threshold,
+		failures:  map[univ.LectureID]int{},
+	}
+}
+
+// allow is a lectureFilterFuncType skipping the quarantined lectures.
+func (q *quarantine) allow(l univ.Lecture) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.indexOf(l) < 0
+}
+
+// fail counts the failure of the lecture, and returns true if the lecture has just been quarantined.
+func (q *quarantine) fail(l univ.Lecture, err error, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.failures[l.ID]++
+	if q.failures[l.ID] < q.threshold || q.indexOf(l) >= 0 {
+		return false
+	}
+
+	q.lectures = append(q.lectures, quarantinedLecture{lecture: l, err: err, at: now})
+
+	return true
+}
+
+func (q *quarantine) succeed(l univ.Lecture) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.failures, l.ID)
+}
+
+// release releases the n-th quarantined lecture, or every one if arg is releaseAll.
+func (q *quarantine) release(arg string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if arg == releaseAll {
+		n := len(q.lectures)
+		for _, ql := range q.lectures {
+			delete(q.failures, ql.lecture.ID)
+		}
+		q.lectures = nil
+
+		return n, nil
+	}
+
+	idx, err := strconv.Atoi(arg)
+	if err != nil || idx < 1 || idx > len(q.lectures) {
+		return 0, errors.Errorf("invalid lecture number: %s", arg)
+	}
+
+	delete(q.failures, q.lectures[idx-1].lecture.ID)
+	q.lectures = append(q.lectures[:idx-1:idx-1], q.lectures[idx:]...)
+
+	return 1, nil
+}
+
+func (q *quarantine) report() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.lectures) == 0 {
+		return "No quarantined lectures"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("격리된 강의 목록")
+	for i, ql := range q.lectures {
+		sb.WriteString("\n")
+		sb.WriteString(fmt.Sprintf(
+			"%d. %s - %s (%s): %s",
+			i+1, ql.lecture.SubjectTitle, ql.lecture.Title, ql.at.Format("2006-01-02 15:04"), ql.err.Error(),
+		))
+	}
+
+	return sb.String()
+}
+
+func (q *quarantine) indexOf(l univ.Lecture) int {
+	for i, ql := range q.lectures {
+		if ql.lecture.ID == l.ID {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+
+	"github.com/Kcrong/autostudy/pkg/noti"
+	"github.com/Kcrong/autostudy/pkg/univ"
+)
+
+const (
+	selectActionSubject  = "s"
+	selectActionLecture  = "l"
+	selectActionAll      = "a"
+	selectActionBack     = "b"
+	selectActionCancel   = "x"
+	selectPayloadSep     = ":"
+	maxButtonTitleLength = 40
+)
+
+// selection is the plan scanned for the inline keyboard of `/run --select`.
+type selection struct {
+	id   int
+	plan *univ.Plan
+}
+
+// selector keeps the latest selection. Buttons of older selections are ignored.
+type selector struct {
+	mu      sync.Mutex
+	lastID  int
+	current *selection
+}
+
+func (s *selector) start(plan *univ.Plan) *selection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	s.current = &selection{
+		id:   s.lastID,
+		plan: plan,
+	}
+
+	return s.current
+}
+
+func (s *selector) get(id int) (*selection, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil || s.current.id != id {
+		return nil, false
+	}
+
+	return s.current, true
+}
+
+func (s *selector) done(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current != nil && s.current.id == id {
+		s.current = nil
+	}
+}
+
+// sendSubjectKeyboard replies with the subjects having lectures to watch.
+func (a *app) sendSubjectKeyboard(plan *univ.Plan) error {
+	if len(plan.Pending()) == 0 {
+		return a.bot.SendMessage("No lectures to watch")
+	}
+
+	sel := a.selector.start(plan)
+
+	return a.bot.SendInlineKeyboard("Select a subject to watch", sel.subjectKeyboard())
+}
+
+func (sel *selection) subjectKeyboard() tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, subject := range sel.plan.Subjects() {
+		if subject.IsCompleted() {
+			continue
+		}
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("%s (%.0f%%)", shorten(subject.Title), subject.Progress),
+			sel.data(selectActionSubject, strconv.Itoa(subject.ID)),
+		)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("Cancel", sel.data(selectActionCancel))))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (sel *selection) lectureKeyboard(subject univ.Subject) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for i, lecture := range subject.Lectures {
+		if !lecture.IsReadied || lecture.IsDone() {
+			continue
+		}
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			shorten(lecture.Title),
+			sel.data(selectActionLecture, strconv.Itoa(subject.ID), strconv.Itoa(i)),
+		)))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("All lectures", sel.data(selectActionAll, strconv.Itoa(subject.ID))),
+		tgbotapi.NewInlineKeyboardButtonData("Back", sel.data(selectActionBack)),
+		tgbotapi.NewInlineKeyboardButtonData("Cancel", sel.data(selectActionCancel)),
+	))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (sel *selection) data(action string, args ...string) string {
+	fields := append([]string{strconv.Itoa(sel.id), action}, args...)
+	return noti.CallbackData(commandRun, strings.Join(fields, selectPayloadSep))
+}
+
+func (sel *selection) subject(arg string) (univ.Subject, bool) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return univ.Subject{}, false
+	}
+
+	subjects := sel.plan.Subjects()
+	if id < 0 || id >= len(subjects) {
+		return univ.Subject{}, false
+	}
+
+	return subjects[id], true
+}
+
+// lecture returns the lecture of the selection plan at the positions of the keyboard.
+func (sel *selection) lecture(subjectArg, lectureArg string) (univ.Lecture, bool) {
+	subject, ok := sel.subject(subjectArg)
+	if !ok {
+		return univ.Lecture{}, false
+	}
+
+	idx, err := strconv.Atoi(lectureArg)
+	if err != nil || idx < 0 || idx >= len(subject.Lectures) {
+		return univ.Lecture{}, false
+	}
+
+	return subject.Lectures[idx], true
+}
+
+// handleSelect handles the buttons of the keyboards sent by sendSubjectKeyboard.
+func (a *app) handleSelect(req noti.CallbackRequest) error {
+	messageID := req.Query.Message.MessageID
+
+	fields := strings.Split(req.Data, selectPayloadSep)
+	if len(fields) < 2 {
+		return errors.Errorf("invalid callback data: %s", req.Data)
+	}
+
+	id, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return errors.Wrapf(err, "invalid callback data: %s", req.Data)
+	}
+	action, args := fields[1], fields[2:]
+
+	sel, ok := a.selector.get(id)
+	if !ok {
+		return a.bot.EditInlineKeyboard(messageID, "This selection has expired", nil)
+	}
+
+	switch action {
+	case selectActionSubject, selectActionAll:
+		if len(args) != 1 {
+			return errors.Errorf("invalid callback data: %s", req.Data)
+		}
+		subject, ok := sel.subject(args[0])
+		if !ok {
+			return errors.Errorf("invalid callback data: %s", req.Data)
+		}
+
+		if action == selectActionSubject {
+			markup := sel.lectureKeyboard(subject)
+			return a.bot.EditInlineKeyboard(messageID, "Select lectures of "+subject.Title, &markup)
+		}
+
+		a.selector.done(id)
+		if err := a.bot.EditInlineKeyboard(messageID, "Selected: "+subject.Title, nil); err != nil {
+			return err
+		}
+
+		return a.runSelected(func(l univ.Lecture) bool {
+			return l.ID.Subject == subject.Title
+		})
+	case selectActionLecture:
+		if len(args) != 2 {
+			return errors.Errorf("invalid callback data: %s", req.Data)
+		}
+		lecture, ok := sel.lecture(args[0], args[1])
+		if !ok {
+			return errors.Errorf("invalid callback data: %s", req.Data)
+		}
+
+		a.selector.done(id)
+		target := lecture.SubjectTitle + " - " + lecture.Title
+		if err := a.bot.EditInlineKeyboard(messageID, "Selected: "+target, nil); err != nil {
+			return err
+		}
+
+		return a.runSelected(func(l univ.Lecture) bool {
+			return l.ID == lecture.ID
+		})
+	case selectActionBack:
+		markup := sel.subjectKeyboard()
+		return a.bot.EditInlineKeyboard(messageID, "Select a subject to watch", &markup)
+	case selectActionCancel:
+		a.selector.done(id)
+		return a.bot.EditInlineKeyboard(messageID, "Cancelled", nil)
+	default:
+		return errors.Errorf("invalid callback data: %s", req.Data)
+	}
+}
+
+// runSelected runs the lectures passing filter. The lectures are scanned again, so a filter of the selection
+// must match them by their LectureID, not by their positions in the selection plan which can change in between.
+// The errors are not returned to the router, since watchAll has already reported them.
+func (a *app) runSelected(filter lectureFilterFuncType) error {
+	_ = a.watchAll(filter)
+
+	return nil
+}
+
+func shorten(title string) string {
+	if utf8.RuneCountInString(title) <= maxButtonTitleLength {
+		return title
+	}
+
+	return string([]rune(title)[:maxButtonTitleLength-1]) + "…"
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/failure"
+	"github.com/Kcrong/autostudy/pkg/noti"
+	"github.com/Kcrong/autostudy/pkg/univ"
+)
+
+type lectureFailure struct {
+	lecture univ.Lecture
+	err     error
+}
+
+// runSummary aggregates the results of the sessions of a run.
+type runSummary struct {
+	mu      sync.Mutex
+	watched []univ.Lecture
+	failed  []lectureFailure
+	skipped []univ.Lecture
+	// quarantined are the lectures not watched by the run since they are quarantined.
+	quarantined []univ.Lecture
+	// unsupported are the lectures not watched by the run since their content can not be completed.
+	unsupported []univ.Lecture
+}
+
+func (s *runSummary) addWatched(l univ.Lecture) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.watched = append(s.watched, l)
+}
+
+func (s *runSummary) addFailed(l univ.Lecture, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = append(s.failed, lectureFailure{lecture: l, err: err})
+}
+
+func (s *runSummary) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("실행 결과")
+	sb.WriteString("\n")
+	sb.WriteString(fmt.Sprintf(
+		"Watched: %d, Failed: %d, Skipped: %d, Quarantined: %d, Unsupported: %d",
+		len(s.watched), len(s.failed), len(s.skipped), len(s.quarantined), len(s.unsupported),
+	))
+
+	for _, f := range s.failed {
+		sb.WriteString("\n")
+		sb.WriteString("- failed: " + f.lecture.SubjectTitle + " - " + f.lecture.Title + ": " + f.err.Error())
+	}
+	for _, l := range s.skipped {
+		sb.WriteString("\n")
+		sb.WriteString("- skipped: " + l.SubjectTitle + " - " + l.Title)
+	}
+	for _, l := range s.quarantined {
+		sb.WriteString("\n")
+		sb.WriteString("- quarantined: " + l.SubjectTitle + " - " + l.Title)
+	}
+	for _, l := range s.unsupported {
+		sb.WriteString("\n")
+		sb.WriteString("- unsupported: " + l.SubjectTitle + " - " + l.Title + " (" + l.Type.String() + ")")
+	}
+
+	return sb.String()
+}
+
+func (s *runSummary) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.failed) == 0 && len(s.skipped) == 0 {
+		return nil
+	}
+
+	return errors.Errorf("%d lectures failed, %d lectures skipped", len(s.failed), len(s.skipped))
+}
+
+// watchParallel distributes the lectures to UnivConcurrency workers, each using a session of the pool at a time.
+// A failed lecture is tried again as long as its failure is retryable, then the worker goes on to the next one.
+// A failure aborting the run stops every worker, and is reported once.
+// The lectures left when every worker has stopped are skipped.
+func (a *app) watchParallel(lectures []univ.Lecture, progress *noti.Progress) *runSummary {
+	queue := make(chan univ.Lecture, len(lectures))
+	for _, l := range lectures {
+		queue <- l
+	}
+	close(queue)
+
+	workers := a.c.UnivConcurrency
+	if workers > len(lectures) {
+		workers = len(lectures)
+	}
+
+	summary := &runSummary{}
+
+	var (
+		stop     = make(chan struct{})
+		stopOnce sync.Once
+	)
+	abort := func(l univ.Lecture, err error) {
+		stopOnce.Do(func() {
+			close(stop)
+			a.reportFunc(a.bot.SendMessage(fmt.Sprintf(
+				"Aborted the run at %s - %s: %v", l.SubjectTitle, l.Title, err,
+			)), nil)
+		})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				l, ok := <-queue
+				if !ok {
+					return
+				}
+
+				err := a.watchWithRetry(l, progress)
+				if err == nil {
+					a.quarantine.succeed(l)
+					summary.addWatched(l)
+					continue
+				}
+
+				// NOTE: err itself was reported by withSession.
+				a.reportFunc(progress.FailLecture(l.ID.String()), nil)
+				summary.addFailed(l, err)
+
+				switch failure.ActionOf(err) {
+				case failure.ActionRetry, failure.ActionSkip:
+					// NOTE: The failure belongs to the lecture. Count it, and go on to the next one.
+					if a.quarantine.fail(l, err, a.nowFunc()) {
+						a.reportFunc(a.bot.SendMessage(fmt.Sprintf(
+							"Quarantined %s - %s after failing %d runs. Release it with /%s",
+							l.SubjectTitle, l.Title, a.c.Retry.QuarantineAfter, commandRelease,
+						)), nil)
+					}
+				default:
+					abort(l, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for l := range queue {
+		summary.skipped = append(summary.skipped, l)
+	}
+
+	return summary
+}
+
+// watchWithRetry watches the lecture with a session of the pool.
+// It tries again with backoff while the failure is retryable, up to Retry.Attempts times.
+func (a *app) watchWithRetry(l univ.Lecture, progress *noti.Progress) error {
+	backoff := a.c.Retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := a.withSession(func(wd selenium.WebDriver) error {
+			return univ.NewExecutor(wd, a.c.Url.Lecture, a.auth, progress, a.content(), a.watchdog()).Watch(l)
+		})
+		if err == nil || failure.ActionOf(err) != failure.ActionRetry || attempt >= a.c.Retry.Attempts {
+			return err
+		}
+
+		log.Warnf("Try %s - %s again in %s: %v", l.SubjectTitle, l.Title, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (a *app) content() univ.ContentOption {
+	return univ.ContentOption{AnswerSurveys: a.c.AnswerSurveys}
+}
+
+// watchdog reports each recovery of a stalled playback.
+func (a *app) watchdog() univ.Watchdog {
+	return univ.Watchdog{
+		PollInterval: a.c.Playback.PollInterval,
+		StallTimeout: a.c.Playback.StallTimeout,
+		RecoveryFunc: func(l univ.Lecture, step univ.RecoveryStep, location time.Duration) {
+			a.reportFunc(a.bot.SendMessage(fmt.Sprintf(
+				"Playback of %s - %s stalled at %s. Trying to %s",
+				l.SubjectTitle, l.Title, location, step,
+			)), nil)
+		},
+	}
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -19,24 +21,126 @@ type UrlConfig struct {
 	Lecture   string
 }
 
+type TelegramWebhookConfig struct {
+	// Set to true if you want to receive updates via webhook instead of long polling
+	Enabled     bool
+	ListenAddr  string
+	Path        string
+	SecretToken string
+	// PublicURL is registered to telegram via setWebhook if not empty.
+	PublicURL string
+}
+
+// FilterConfig decides which lectures are watched, and in which order.
+// Patterns are regular expressions matched against the titles.
+type FilterConfig struct {
+	SubjectInclude string
+	SubjectExclude string
+	LectureInclude string
+	LectureExclude string
+	// Order is one of dom, deadline, shortest and priority.
+	Order string
+	// SubjectPriority is the patterns of the subjects to process first, used by the priority order.
+	// They are separated by PatternSeparator.
+	SubjectPriority []string
+}
+
+// SessionConfig decides how long the browser sessions are kept and reused.
+type SessionConfig struct {
+	// MaxSessions caps the sessions open at the same time. Match it to SE_NODE_MAX_SESSIONS of the grid.
+	MaxSessions int
+	// MaxUses is the number of commands or lectures a session is used for before it is recycled.
+	MaxUses int
+	// MaxMemoryMB is the JS heap size of the page in megabytes after which a session is recycled.
+	MaxMemoryMB int64
+	MaxIdleTime time.Duration
+	// RegistryPath is the file recording the sessions opened, to delete them from the grid after a crash.
+	RegistryPath string
+	// ReapInterval is the interval to delete the orphaned sessions from the grid.
+	ReapInterval time.Duration
+}
+
+// BrowserConfig is the profile of the browser sessions.
+type BrowserConfig struct {
+	// Args are extra chrome arguments, separated by commas.
+	Args []string
+	// WindowSize is formatted as WIDTH,HEIGHT.
+	WindowSize string
+	Language   string
+	UserAgent  string
+	// Proxy is a URL of a HTTP or a SOCKS proxy, such as socks5://host:port.
+	Proxy       string
+	DownloadDir string
+	// UserDataDir keeps the browser data between the sessions. It requires SESSION_MAX_SESSIONS to be 1.
+	UserDataDir     string
+	PageLoadTimeout time.Duration
+	ScriptTimeout   time.Duration
+}
+
+// RetryConfig decides how a failed lecture is tried again.
+type RetryConfig struct {
+	// Attempts is the number of times a lecture is tried in a run.
+	Attempts int
+	// Backoff is the wait before the second attempt, doubled for each later one.
+	Backoff time.Duration
+	// QuarantineAfter is the number of runs a lecture can fail in, before it is skipped until released.
+	QuarantineAfter int
+}
+
+// DialogConfig decides how the alerts of the LMS are handled.
+type DialogConfig struct {
+	// Rules are in the form of "action:pattern", where action is one of accept, dismiss, abort and notify,
+	// and pattern is a regular expression matched against the text of the alert. The first matching rule is used.
+	// They are separated by PatternSeparator.
+	Rules []string
+	// DefaultAction is the action for the alerts matching no rule.
+	DefaultAction string
+}
+
+// PlaybackConfig decides when a playback is considered stalled.
+type PlaybackConfig struct {
+	// PollInterval is how often the playback location is read.
+	PollInterval time.Duration
+	// StallTimeout is how long the playback location can stay still, before the playback is recovered.
+	StallTimeout time.Duration
+}
+
 type Config struct {
 	ENV        string
 	CommitHash string
 
 	SeleniumWebDriverHost string
+	Session               SessionConfig
+	Browser               BrowserConfig
 
 	UnivID string
 	UnivPW string
-	Url    UrlConfig
+	// CookieSecret encrypts the cookies saved to CookieStorePath to skip the login. Cookies are kept in memory only if empty.
+	CookieSecret    string
+	CookieStorePath string
+	// UnivConcurrency is the number of browser sessions the account watches lectures with at the same time.
+	UnivConcurrency int
+	Url             UrlConfig
+	Filter          FilterConfig
+	Retry           RetryConfig
+	Playback        PlaybackConfig
+	Dialog          DialogConfig
+	// AnswerSurveys submits the survey lectures with the first choice of each question. They are unsupported otherwise.
+	AnswerSurveys bool
 
 	TelegramToken  string
 	TelegramChatID int64
+	// TelegramOwnerIDs are the users allowed to run owner commands. Everyone in the chat if empty.
+	TelegramOwnerIDs []int64
+	TelegramWebhook  TelegramWebhookConfig
+	// TelegramOTPTimeout is how long the one-time code of the login is waited for in telegram.
+	TelegramOTPTimeout time.Duration
 
 	SentryDSN string
 
 	// IsProduction is true if ENV is EnvProduction
 	IsProduction bool
-	// Set to true if you want to run browser locally
+	// Set to true if you want to run browser locally. SeleniumWebDriverHost is not used then.
 	UseLocalBrowser  bool
 	LocalBrowserPath string
 	// Set to true if you want to run browser headless
@@ -50,6 +154,53 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvOrDefault is getEnv treating an empty value as unset, since .env.example sets every key empty.
+func getEnvOrDefault(key, fallback string) string {
+	if v := getEnv(key, ""); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func parseStringList(v string) []string {
+	var values []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+
+	return values
+}
+
+// PatternSeparator separates the regular expressions of a list, since a comma can be a part of them, e.g. {1,3}.
+const PatternSeparator = ";;"
+
+// SplitPatterns splits the regular expressions separated by PatternSeparator.
+func SplitPatterns(v string) []string {
+	var patterns []string
+	for _, s := range strings.Split(v, PatternSeparator) {
+		if s = strings.TrimSpace(s); s != "" {
+			patterns = append(patterns, s)
+		}
+	}
+
+	return patterns
+}
+
+func parseInt64List(v string) ([]int64, error) {
+	var values []int64
+	for _, s := range parseStringList(v) {
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "strconv.ParseInt")
+		}
+		values = append(values, i)
+	}
+
+	return values, nil
+}
+
 func NewConfig() (Config, error) {
 	env := getEnv("ENV", EnvDevelopment)
 	isProd := env == EnvProduction
@@ -59,6 +210,11 @@ func NewConfig() (Config, error) {
 		return Config{}, errors.Wrapf(err, "invalid chat_id: %s", getEnv("TELEGRAM_CHAT_ID", ""))
 	}
 
+	ownerIDs, err := parseInt64List(getEnv("TELEGRAM_OWNER_IDS", ""))
+	if err != nil {
+		return Config{}, errors.Wrapf(err, "invalid TELEGRAM_OWNER_IDS: %s", getEnv("TELEGRAM_OWNER_IDS", ""))
+	}
+
 	useLocalBrowser := !isProd
 	if v := getEnv("USE_LOCAL_BROWSER", ""); v != "" {
 		useLocalBrowser, err = strconv.ParseBool(v)
@@ -75,24 +231,235 @@ func NewConfig() (Config, error) {
 		}
 	}
 
+	concurrency := 1
+	if v := getEnv("UNIV_CONCURRENCY", ""); v != "" {
+		concurrency, err = strconv.Atoi(v)
+		if err != nil || concurrency < 1 {
+			return Config{}, errors.Errorf("invalid UNIV_CONCURRENCY: %s", v)
+		}
+	}
+
+	maxSessions := concurrency
+	if v := getEnv("SESSION_MAX_SESSIONS", ""); v != "" {
+		maxSessions, err = strconv.Atoi(v)
+		if err != nil || maxSessions < 1 {
+			return Config{}, errors.Errorf("invalid SESSION_MAX_SESSIONS: %s", v)
+		}
+	}
+
+	maxUses := 10
+	if v := getEnv("SESSION_MAX_USES", ""); v != "" {
+		maxUses, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid SESSION_MAX_USES: %s", v)
+		}
+	}
+
+	maxMemoryMB := int64(1024)
+	if v := getEnv("SESSION_MAX_MEMORY_MB", ""); v != "" {
+		maxMemoryMB, err = strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid SESSION_MAX_MEMORY_MB: %s", v)
+		}
+	}
+
+	maxIdleTime := 30 * time.Minute
+	if v := getEnv("SESSION_MAX_IDLE_TIME", ""); v != "" {
+		maxIdleTime, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid SESSION_MAX_IDLE_TIME: %s", v)
+		}
+	}
+
+	reapInterval := 10 * time.Minute
+	if v := getEnv("SESSION_REAP_INTERVAL", ""); v != "" {
+		reapInterval, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid SESSION_REAP_INTERVAL: %s", v)
+		}
+		if reapInterval <= 0 {
+			return Config{}, errors.Errorf("invalid SESSION_REAP_INTERVAL: %s", v)
+		}
+	}
+
+	pageLoadTimeout := time.Minute
+	if v := getEnv("BROWSER_PAGE_LOAD_TIMEOUT", ""); v != "" {
+		pageLoadTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid BROWSER_PAGE_LOAD_TIMEOUT: %s", v)
+		}
+	}
+
+	scriptTimeout := 30 * time.Second
+	if v := getEnv("BROWSER_SCRIPT_TIMEOUT", ""); v != "" {
+		scriptTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid BROWSER_SCRIPT_TIMEOUT: %s", v)
+		}
+	}
+
+	// NOTE: Chrome refuses to open a user data directory used by another browser.
+	userDataDir := getEnv("BROWSER_USER_DATA_DIR", "")
+	if userDataDir != "" && maxSessions > 1 {
+		return Config{}, errors.New("BROWSER_USER_DATA_DIR requires SESSION_MAX_SESSIONS to be 1")
+	}
+
+	otpTimeout := 5 * time.Minute
+	if v := getEnv("TELEGRAM_OTP_TIMEOUT", ""); v != "" {
+		otpTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid TELEGRAM_OTP_TIMEOUT: %s", v)
+		}
+		if otpTimeout <= 0 {
+			return Config{}, errors.Errorf("invalid TELEGRAM_OTP_TIMEOUT: %s", v)
+		}
+	}
+
+	retryAttempts := 2
+	if v := getEnv("LECTURE_RETRY_ATTEMPTS", ""); v != "" {
+		retryAttempts, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid LECTURE_RETRY_ATTEMPTS: %s", v)
+		}
+		if retryAttempts < 1 {
+			return Config{}, errors.Errorf("invalid LECTURE_RETRY_ATTEMPTS: %s", v)
+		}
+	}
+
+	retryBackoff := 30 * time.Second
+	if v := getEnv("LECTURE_RETRY_BACKOFF", ""); v != "" {
+		retryBackoff, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid LECTURE_RETRY_BACKOFF: %s", v)
+		}
+		if retryBackoff < 0 {
+			return Config{}, errors.Errorf("invalid LECTURE_RETRY_BACKOFF: %s", v)
+		}
+	}
+
+	quarantineAfter := 3
+	if v := getEnv("LECTURE_QUARANTINE_AFTER", ""); v != "" {
+		quarantineAfter, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid LECTURE_QUARANTINE_AFTER: %s", v)
+		}
+		if quarantineAfter < 1 {
+			return Config{}, errors.Errorf("invalid LECTURE_QUARANTINE_AFTER: %s", v)
+		}
+	}
+
+	playbackPollInterval := 15 * time.Second
+	if v := getEnv("PLAYBACK_POLL_INTERVAL", ""); v != "" {
+		playbackPollInterval, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid PLAYBACK_POLL_INTERVAL: %s", v)
+		}
+		if playbackPollInterval <= 0 {
+			return Config{}, errors.Errorf("invalid PLAYBACK_POLL_INTERVAL: %s", v)
+		}
+	}
+
+	playbackStallTimeout := 3 * time.Minute
+	if v := getEnv("PLAYBACK_STALL_TIMEOUT", ""); v != "" {
+		playbackStallTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid PLAYBACK_STALL_TIMEOUT: %s", v)
+		}
+	}
+	if playbackStallTimeout <= 0 || playbackStallTimeout < playbackPollInterval {
+		return Config{}, errors.Errorf("PLAYBACK_STALL_TIMEOUT %s must be positive and not shorter than PLAYBACK_POLL_INTERVAL %s", playbackStallTimeout, playbackPollInterval)
+	}
+
+	answerSurveys := false
+	if v := getEnv("LECTURE_ANSWER_SURVEYS", ""); v != "" {
+		answerSurveys, err = strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid LECTURE_ANSWER_SURVEYS: %s", v)
+		}
+	}
+
+	webhookEnabled := false
+	if v := getEnv("TELEGRAM_WEBHOOK_ENABLED", ""); v != "" {
+		webhookEnabled, err = strconv.ParseBool(v)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "invalid TELEGRAM_WEBHOOK_ENABLED: %s", v)
+		}
+	}
+	if webhookEnabled && getEnv("TELEGRAM_WEBHOOK_SECRET_TOKEN", "") == "" {
+		return Config{}, errors.New("TELEGRAM_WEBHOOK_SECRET_TOKEN is required when TELEGRAM_WEBHOOK_ENABLED is set")
+	}
+
 	return Config{
 		ENV:                   env,
 		CommitHash:            getEnv("COMMIT_HASH", "not-available"),
 		SeleniumWebDriverHost: getEnv("SELENIUM_WEB_DRIVER_HOST", ""),
-		UnivID:                getEnv("UNIV_ID", ""),
-		UnivPW:                getEnv("UNIV_PW", ""),
+		Session: SessionConfig{
+			MaxSessions:  maxSessions,
+			MaxUses:      maxUses,
+			MaxMemoryMB:  maxMemoryMB,
+			MaxIdleTime:  maxIdleTime,
+			RegistryPath: getEnvOrDefault("SESSION_REGISTRY_PATH", "sessions.json"),
+			ReapInterval: reapInterval,
+		},
+		Browser: BrowserConfig{
+			Args:            parseStringList(getEnv("BROWSER_ARGS", "")),
+			WindowSize:      getEnvOrDefault("BROWSER_WINDOW_SIZE", "1920,1080"),
+			Language:        getEnvOrDefault("BROWSER_LANGUAGE", "ko-KR"),
+			UserAgent:       getEnvOrDefault("BROWSER_USER_AGENT", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.87 Safari/537.36"),
+			Proxy:           getEnv("BROWSER_PROXY", ""),
+			DownloadDir:     getEnv("BROWSER_DOWNLOAD_DIR", ""),
+			UserDataDir:     userDataDir,
+			PageLoadTimeout: pageLoadTimeout,
+			ScriptTimeout:   scriptTimeout,
+		},
+		UnivID:          getEnv("UNIV_ID", ""),
+		UnivPW:          getEnv("UNIV_PW", ""),
+		CookieSecret:    getEnv("COOKIE_SECRET", ""),
+		CookieStorePath: getEnvOrDefault("COOKIE_STORE_PATH", "cookies.bin"),
+		UnivConcurrency: concurrency,
 		Url: UrlConfig{
 			Main:      getEnv("URL_MAIN", ""),
 			MyProfile: getEnv("URL_MY_PROFILE", ""),
 			Login:     getEnv("URL_LOGIN", ""),
 			Lecture:   getEnv("URL_LECTURE_PAGE", ""),
 		},
-		TelegramToken:     getEnv("TELEGRAM_API_TOKEN", ""),
-		TelegramChatID:    chatID,
-		SentryDSN:         getEnv("SENTRY_DSN", ""),
-		IsProduction:      isProd,
-		UseLocalBrowser:   useLocalBrowser,
-		LocalBrowserPath:  getEnv("LOCAL_BROWSER_PATH", "./chromedriver"),
-		ShouldRunHeadless: shouldRunHeadless,
+		Retry: RetryConfig{
+			Attempts:        retryAttempts,
+			Backoff:         retryBackoff,
+			QuarantineAfter: quarantineAfter,
+		},
+		AnswerSurveys: answerSurveys,
+		Dialog: DialogConfig{
+			Rules:         SplitPatterns(getEnvOrDefault("DIALOG_RULES", "notify:공지")),
+			DefaultAction: getEnvOrDefault("DIALOG_DEFAULT_ACTION", "accept"),
+		},
+		Playback: PlaybackConfig{
+			PollInterval: playbackPollInterval,
+			StallTimeout: playbackStallTimeout,
+		},
+		Filter: FilterConfig{
+			SubjectInclude:  getEnv("SUBJECT_INCLUDE", ""),
+			SubjectExclude:  getEnv("SUBJECT_EXCLUDE", ""),
+			LectureInclude:  getEnv("LECTURE_INCLUDE", ""),
+			LectureExclude:  getEnv("LECTURE_EXCLUDE", ""),
+			Order:           getEnvOrDefault("ORDER_POLICY", "dom"),
+			SubjectPriority: SplitPatterns(getEnv("SUBJECT_PRIORITY", "")),
+		},
+		TelegramToken:    getEnv("TELEGRAM_API_TOKEN", ""),
+		TelegramChatID:   chatID,
+		TelegramOwnerIDs: ownerIDs,
+		TelegramWebhook: TelegramWebhookConfig{
+			Enabled:     webhookEnabled,
+			ListenAddr:  getEnvOrDefault("TELEGRAM_WEBHOOK_LISTEN_ADDR", ":8080"),
+			Path:        getEnvOrDefault("TELEGRAM_WEBHOOK_PATH", "/telegram/webhook"),
+			SecretToken: getEnv("TELEGRAM_WEBHOOK_SECRET_TOKEN", ""),
+			PublicURL:   getEnv("TELEGRAM_WEBHOOK_URL", ""),
+		},
+		TelegramOTPTimeout: otpTimeout,
+		SentryDSN:          getEnv("SENTRY_DSN", ""),
+		IsProduction:       isProd,
+		UseLocalBrowser:    useLocalBrowser,
+		LocalBrowserPath:   getEnv("LOCAL_BROWSER_PATH", "./chromedriver"),
+		ShouldRunHeadless:  shouldRunHeadless,
 	}, nil
 }
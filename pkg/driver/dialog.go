@@ -0,0 +1,393 @@
+package driver
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/failure"
+)
+
+type DialogAction string
+
+const (
+	DialogAccept  DialogAction = "accept"
+	DialogDismiss DialogAction = "dismiss"
+	// DialogAbort accepts the alert, then fails the command with failure.ErrDialogAborted.
+	DialogAbort DialogAction = "abort"
+	// DialogNotify accepts the alert, then notifies its text.
+	DialogNotify DialogAction = "notify"
+)
+
+func ParseDialogAction(action string) (DialogAction, error) {
+	switch a := DialogAction(action); a {
+	case DialogAccept, DialogDismiss, DialogAbort, DialogNotify:
+		return a, nil
+	default:
+		return "", errors.Errorf("invalid dialog action: %s", action)
+	}
+}
+
+// DialogRule handles the alerts whose text matches Pattern.
+type DialogRule struct {
+	Action  DialogAction
+	Pattern *regexp.Regexp
+}
+
+// NewDialogRule parses the rule in the form of "action:pattern".
+func NewDialogRule(rule string) (DialogRule, error) {
+	action, pattern, ok := strings.Cut(rule, ":")
+	if !ok {
+		return DialogRule{}, errors.Errorf("invalid dialog rule: %s", rule)
+	}
+
+	a, err := ParseDialogAction(strings.TrimSpace(action))
+	if err != nil {
+		return DialogRule{}, err
+	}
+
+	p, err := regexp.Compile(pattern)
+	if err != nil {
+		return DialogRule{}, errors.Wrapf(err, "regexp.Compile(%s)", pattern)
+	}
+
+	return DialogRule{
+		Action:  a,
+		Pattern: p,
+	}, nil
+}
+
+// DialogHandler handles the alert open, by the first rule matching its text.
+type DialogHandler struct {
+	Rules []DialogRule
+	// Default is the action for the alerts matching no rule.
+	Default DialogAction
+	// NotifyFunc is called with the text of the alerts handled by DialogNotify.
+	NotifyFunc func(text string)
+}
+
+func (h *DialogHandler) action(text string) DialogAction {
+	for _, r := range h.Rules {
+		if r.Pattern.MatchString(text) {
+			return r.Action
+		}
+	}
+
+	if h.Default == "" {
+		return DialogAccept
+	}
+
+	return h.Default
+}
+
+// Handle handles the alert open in wd. It does nothing if no alert is open.
+func (h *DialogHandler) Handle(wd selenium.WebDriver) error {
+	text, err := wd.AlertText()
+	if err != nil {
+		// NOTE: No alert is open.
+		return nil
+	}
+
+	action := h.action(text)
+	log.Infof("Handled alert by %s: %s", action, text)
+
+	if action == DialogDismiss {
+		return errors.Wrap(wd.DismissAlert(), "wd.DismissAlert()")
+	}
+	if err := wd.AcceptAlert(); err != nil {
+		return errors.Wrap(err, "wd.AcceptAlert()")
+	}
+
+	switch action {
+	case DialogAbort:
+		return failure.Wrap(errors.Errorf("alert: %s", text), failure.ErrDialogAborted)
+	case DialogNotify:
+		if h.NotifyFunc != nil {
+			h.NotifyFunc(text)
+		}
+	}
+
+	return nil
+}
+
+// do handles the alert before f, and again before retrying f if an alert was opened in the meantime.
+func (h *DialogHandler) do(wd selenium.WebDriver, f func() error) error {
+	if err := h.Handle(wd); err != nil {
+		return err
+	}
+
+	err := f()
+	if hasSeleniumError(err, "unexpected alert open") {
+		if err := h.Handle(wd); err != nil {
+			return err
+		}
+		err = f()
+	}
+
+	return err
+}
+
+// dialogDriver handles the alert open before each command which an alert would block.
+// The elements it finds are wrapped by dialogElement, and the conditions of Wait are called with it,
+// so that their commands are handled too.
+type dialogDriver struct {
+	selenium.WebDriver
+	handler *DialogHandler
+}
+
+// WithDialogHandler returns wd handling the alerts by handler before its commands and the ones of its elements.
+func WithDialogHandler(wd selenium.WebDriver, handler *DialogHandler) selenium.WebDriver {
+	if handler == nil {
+		return wd
+	}
+
+	return &dialogDriver{WebDriver: WithoutDialogHandler(wd), handler: handler}
+}
+
+// WithoutDialogHandler returns the driver wrapped by WithDialogHandler, for the callers reading the alerts themselves.
+func WithoutDialogHandler(wd selenium.WebDriver) selenium.WebDriver {
+	if d, ok := wd.(*dialogDriver); ok {
+		return d.WebDriver
+	}
+
+	return wd
+}
+
+// HandleDialog handles the alert open in wd by the handler of WithDialogHandler, or accepts it if wd has none.
+func HandleDialog(wd selenium.WebDriver) error {
+	if d, ok := wd.(*dialogDriver); ok {
+		return d.handler.Handle(d.WebDriver)
+	}
+
+	_ = wd.AcceptAlert()
+
+	return nil
+}
+
+func (d *dialogDriver) do(f func() error) error {
+	return d.handler.do(d.WebDriver, f)
+}
+
+func (d *dialogDriver) wrap(element selenium.WebElement) selenium.WebElement {
+	if element == nil {
+		return nil
+	}
+
+	return &dialogElement{WebElement: element, driver: d}
+}
+
+func (d *dialogDriver) wrapAll(elements []selenium.WebElement) []selenium.WebElement {
+	for i := range elements {
+		elements[i] = d.wrap(elements[i])
+	}
+
+	return elements
+}
+
+func (d *dialogDriver) Get(url string) error {
+	return d.do(func() error {
+		return d.WebDriver.Get(url)
+	})
+}
+
+func (d *dialogDriver) Refresh() error {
+	return d.do(d.WebDriver.Refresh)
+}
+
+func (d *dialogDriver) CurrentURL() (string, error) {
+	var url string
+	err := d.do(func() (err error) {
+		url, err = d.WebDriver.CurrentURL()
+		return err
+	})
+	return url, err
+}
+
+func (d *dialogDriver) Title() (string, error) {
+	var title string
+	err := d.do(func() (err error) {
+		title, err = d.WebDriver.Title()
+		return err
+	})
+	return title, err
+}
+
+func (d *dialogDriver) ActiveElement() (selenium.WebElement, error) {
+	var element selenium.WebElement
+	err := d.do(func() (err error) {
+		element, err = d.WebDriver.ActiveElement()
+		return err
+	})
+	return d.wrap(element), err
+}
+
+func (d *dialogDriver) FindElement(by, value string) (selenium.WebElement, error) {
+	var element selenium.WebElement
+	err := d.do(func() (err error) {
+		element, err = d.WebDriver.FindElement(by, value)
+		return err
+	})
+	return d.wrap(element), err
+}
+
+func (d *dialogDriver) FindElements(by, value string) ([]selenium.WebElement, error) {
+	var elements []selenium.WebElement
+	err := d.do(func() (err error) {
+		elements, err = d.WebDriver.FindElements(by, value)
+		return err
+	})
+	return d.wrapAll(elements), err
+}
+
+func (d *dialogDriver) ExecuteScript(script string, args []interface{}) (interface{}, error) {
+	var result interface{}
+	err := d.do(func() (err error) {
+		result, err = d.WebDriver.ExecuteScript(script, args)
+		return err
+	})
+	return result, err
+}
+
+func (d *dialogDriver) CurrentWindowHandle() (string, error) {
+	var handle string
+	err := d.do(func() (err error) {
+		handle, err = d.WebDriver.CurrentWindowHandle()
+		return err
+	})
+	return handle, err
+}
+
+func (d *dialogDriver) WindowHandles() ([]string, error) {
+	var handles []string
+	err := d.do(func() (err error) {
+		handles, err = d.WebDriver.WindowHandles()
+		return err
+	})
+	return handles, err
+}
+
+func (d *dialogDriver) CloseWindow(name string) error {
+	return d.do(func() error {
+		return d.WebDriver.CloseWindow(name)
+	})
+}
+
+func (d *dialogDriver) SwitchWindow(name string) error {
+	return d.do(func() error {
+		return d.WebDriver.SwitchWindow(name)
+	})
+}
+
+func (d *dialogDriver) SwitchFrame(frame interface{}) error {
+	return d.do(func() error {
+		return d.WebDriver.SwitchFrame(frame)
+	})
+}
+
+func (d *dialogDriver) Close() error {
+	return d.do(d.WebDriver.Close)
+}
+
+// condition calls c with d instead of the driver wrapped.
+func (d *dialogDriver) condition(c selenium.Condition) selenium.Condition {
+	return func(selenium.WebDriver) (bool, error) {
+		return c(d)
+	}
+}
+
+func (d *dialogDriver) Wait(condition selenium.Condition) error {
+	return d.WebDriver.Wait(d.condition(condition))
+}
+
+func (d *dialogDriver) WaitWithTimeout(condition selenium.Condition, timeout time.Duration) error {
+	return d.WebDriver.WaitWithTimeout(d.condition(condition), timeout)
+}
+
+func (d *dialogDriver) WaitWithTimeoutAndInterval(condition selenium.Condition, timeout, interval time.Duration) error {
+	return d.WebDriver.WaitWithTimeoutAndInterval(d.condition(condition), timeout, interval)
+}
+
+// dialogElement handles the alert open before each command of the element which an alert would block.
+type dialogElement struct {
+	selenium.WebElement
+	driver *dialogDriver
+}
+
+// MarshalJSON marshals the element wrapped, so that it can be passed to SwitchFrame and ExecuteScript.
+func (e *dialogElement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.WebElement)
+}
+
+func (e *dialogElement) Click() error {
+	return e.driver.do(e.WebElement.Click)
+}
+
+func (e *dialogElement) SendKeys(keys string) error {
+	return e.driver.do(func() error {
+		return e.WebElement.SendKeys(keys)
+	})
+}
+
+func (e *dialogElement) Submit() error {
+	return e.driver.do(e.WebElement.Submit)
+}
+
+func (e *dialogElement) Clear() error {
+	return e.driver.do(e.WebElement.Clear)
+}
+
+func (e *dialogElement) MoveTo(xOffset, yOffset int) error {
+	return e.driver.do(func() error {
+		return e.WebElement.MoveTo(xOffset, yOffset)
+	})
+}
+
+func (e *dialogElement) FindElement(by, value string) (selenium.WebElement, error) {
+	var element selenium.WebElement
+	err := e.driver.do(func() (err error) {
+		element, err = e.WebElement.FindElement(by, value)
+		return err
+	})
+	return e.driver.wrap(element), err
+}
+
+func (e *dialogElement) FindElements(by, value string) ([]selenium.WebElement, error) {
+	var elements []selenium.WebElement
+	err := e.driver.do(func() (err error) {
+		elements, err = e.WebElement.FindElements(by, value)
+		return err
+	})
+	return e.driver.wrapAll(elements), err
+}
+
+func (e *dialogElement) Text() (string, error) {
+	var text string
+	err := e.driver.do(func() (err error) {
+		text, err = e.WebElement.Text()
+		return err
+	})
+	return text, err
+}
+
+func (e *dialogElement) GetAttribute(name string) (string, error) {
+	var value string
+	err := e.driver.do(func() (err error) {
+		value, err = e.WebElement.GetAttribute(name)
+		return err
+	})
+	return value, err
+}
+
+func (e *dialogElement) IsDisplayed() (bool, error) {
+	var displayed bool
+	err := e.driver.do(func() (err error) {
+		displayed, err = e.WebElement.IsDisplayed()
+		return err
+	})
+	return displayed, err
+}
@@ -0,0 +1,99 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+)
+
+const (
+	defaultRetryAttempts = 5
+	defaultRetryBackoff  = 200 * time.Millisecond
+	maxRetryBackoff      = 2 * time.Second
+)
+
+// Locator finds an element when an action is taken, so that the action never uses a stale element.
+type Locator struct {
+	// Name describes the element in errors.
+	Name string
+	Find func(selenium.WebDriver) (selenium.WebElement, error)
+}
+
+func (l Locator) String() string {
+	return l.Name
+}
+
+// Click finds the element, scrolls it into view and clicks it.
+// It retries with backoff if the element went stale or the click was intercepted by another element.
+func Click(wd selenium.WebDriver, locator Locator) error {
+	return retry(locator, func() error {
+		element, err := locator.Find(wd)
+		if err != nil {
+			return err
+		}
+
+		// NOTE: Even if fails to scroll, try to click.
+		_ = ScrollIntoView(wd, element)
+
+		return element.Click()
+	})
+}
+
+// Resolve finds the element, retrying with backoff if it went stale while being found.
+func Resolve(wd selenium.WebDriver, locator Locator) (selenium.WebElement, error) {
+	var element selenium.WebElement
+	err := retry(locator, func() error {
+		var err error
+		element, err = locator.Find(wd)
+		return err
+	})
+
+	return element, err
+}
+
+func ScrollIntoView(wd selenium.WebDriver, element selenium.WebElement) error {
+	_, err := wd.ExecuteScript(`arguments[0].scrollIntoView({block: "center", inline: "center"});`, []interface{}{element})
+	return errors.Wrap(err, "wd.ExecuteScript(scrollIntoView)")
+}
+
+func retry(locator Locator, f func() error) error {
+	backoff := defaultRetryBackoff
+
+	var err error
+	for attempt := 1; attempt <= defaultRetryAttempts; attempt++ {
+		if err = f(); err == nil || !isRetryableError(err) {
+			break
+		}
+
+		if attempt < defaultRetryAttempts {
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+	}
+
+	return errors.Wrapf(err, "locator %s", locator)
+}
+
+func isRetryableError(err error) bool {
+	return IsStaleElementError(err) || IsClickInterceptedError(err)
+}
+
+func IsStaleElementError(err error) bool {
+	return hasSeleniumError(err, "stale element reference")
+}
+
+func IsClickInterceptedError(err error) bool {
+	return hasSeleniumError(err, "element click intercepted")
+}
+
+func hasSeleniumError(err error, code string) bool {
+	var seleniumErr *selenium.Error
+	if !errors.As(err, &seleniumErr) {
+		return false
+	}
+
+	return seleniumErr.Err == code
+}
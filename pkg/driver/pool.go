@@ -0,0 +1,217 @@
+package driver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+)
+
+// SessionFactoryFuncType opens a new browser session, returning the function closing it.
+type SessionFactoryFuncType func() (selenium.WebDriver, func() error, error)
+
+type PoolOption struct {
+	// MaxSessions caps the sessions open at the same time, both idle and in use.
+	MaxSessions int
+	// MaxUses is the number of times a session is acquired before it is recycled. Unlimited if 0.
+	MaxUses int
+	// MaxMemoryBytes is the JS heap size of the page after which a session is recycled. Unlimited if 0.
+	MaxMemoryBytes int64
+	// MaxIdleTime is the time an idle session is kept warm. Unlimited if 0.
+	MaxIdleTime time.Duration
+}
+
+// Session is a browser session owned by a Pool.
+type Session struct {
+	selenium.WebDriver
+
+	closeFunc  func() error
+	uses       int
+	releasedAt time.Time
+}
+
+// Uses returns the number of times the session has been released. It is 0 for a new session.
+func (s *Session) Uses() int {
+	return s.uses
+}
+
+// Pool keeps the browser sessions warm between uses, so that they do not have to be opened and logged in every time.
+type Pool struct {
+	newFunc SessionFactoryFuncType
+	opt     PoolOption
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	open   int
+	idle   []*Session
+	closed bool
+}
+
+func NewPool(newFunc SessionFactoryFuncType, opt PoolOption) *Pool {
+	if opt.MaxSessions < 1 {
+		opt.MaxSessions = 1
+	}
+
+	p := &Pool{
+		newFunc: newFunc,
+		opt:     opt,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	return p
+}
+
+// Acquire returns a healthy idle session, or opens a new one.
+// It blocks while MaxSessions sessions are in use.
+func (p *Pool) Acquire() (*Session, error) {
+	p.mu.Lock()
+	for {
+		if p.closed {
+			p.mu.Unlock()
+			return nil, errors.New("pool is closed")
+		}
+
+		if n := len(p.idle); n > 0 {
+			// NOTE: The most recently used session is the most likely to be healthy.
+			s := p.idle[n-1]
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+
+			if err := p.check(s); err != nil {
+				log.Warnf("discard an unhealthy session: %+v", err)
+				if err := p.discard(s); err != nil {
+					// NOTE: The session left on the grid is deleted by the Reaper.
+					log.Warnf("%+v", err)
+				}
+
+				p.mu.Lock()
+				continue
+			}
+
+			return s, nil
+		}
+
+		if p.open < p.opt.MaxSessions {
+			p.open++
+			p.mu.Unlock()
+
+			wd, closeFunc, err := p.newFunc()
+			if err != nil {
+				if closeFunc != nil {
+					_ = closeFunc()
+				}
+				p.forget()
+				return nil, err
+			}
+
+			return &Session{WebDriver: wd, closeFunc: closeFunc}, nil
+		}
+
+		p.cond.Wait()
+	}
+}
+
+// Release returns the session to the pool.
+// The session is closed instead if it failed, since its state is unknown, or if it should be recycled.
+func (p *Pool) Release(s *Session, failed bool) error {
+	s.uses++
+
+	if failed || p.shouldRecycle(s) {
+		return p.discard(s)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		p.open--
+		p.cond.Broadcast()
+		return s.closeFunc()
+	}
+
+	s.releasedAt = time.Now()
+	p.idle = append(p.idle, s)
+	p.cond.Signal()
+
+	return nil
+}
+
+// Close closes the idle sessions. The sessions in use are closed when released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.open -= len(idle)
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	var errs error
+	for _, s := range idle {
+		errs = appendErrors(errs, s.closeFunc())
+	}
+
+	return errs
+}
+
+func (p *Pool) discard(s *Session) error {
+	defer p.forget()
+
+	return errors.Wrap(s.closeFunc(), "close session")
+}
+
+func (p *Pool) forget() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.open--
+	p.cond.Signal()
+}
+
+// check returns an error if the idle session is too old or does not respond.
+func (p *Pool) check(s *Session) error {
+	if p.opt.MaxIdleTime > 0 && time.Since(s.releasedAt) > p.opt.MaxIdleTime {
+		return errors.Errorf("idle for %s", time.Since(s.releasedAt).Truncate(time.Second))
+	}
+
+	// NOTE: The grid drops the session after SE_NODE_SESSION_TIMEOUT, which is only found by a command.
+	_, err := s.CurrentURL()
+	return errors.Wrap(err, "s.CurrentURL")
+}
+
+func (p *Pool) shouldRecycle(s *Session) bool {
+	if p.opt.MaxUses > 0 && s.uses >= p.opt.MaxUses {
+		return true
+	}
+
+	if p.opt.MaxMemoryBytes > 0 {
+		used, err := UsedMemory(s)
+		if err != nil {
+			log.Warnf("recycle a session failed to report its memory: %+v", err)
+			return true
+		}
+		if used > p.opt.MaxMemoryBytes {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UsedMemory returns the JS heap size used by the current page.
+// It is 0 if the browser does not report it.
+func UsedMemory(wd selenium.WebDriver) (int64, error) {
+	v, err := wd.ExecuteScript(`return window.performance.memory ? window.performance.memory.usedJSHeapSize : 0;`, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "wd.ExecuteScript(usedJSHeapSize)")
+	}
+
+	used, ok := v.(float64)
+	if !ok {
+		return 0, errors.Errorf("unexpected usedJSHeapSize: %v", v)
+	}
+
+	return int64(used), nil
+}
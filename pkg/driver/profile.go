@@ -0,0 +1,128 @@
+package driver
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+	"github.com/tebeka/selenium/chrome"
+)
+
+// Profile is the browser settings of the sessions.
+type Profile struct {
+	Headless bool
+	// Args are passed to chrome in addition to the default ones.
+	Args []string
+	// WindowSize is formatted as WIDTH,HEIGHT.
+	WindowSize string
+	// Language is the accepted language of the browser, such as ko-KR.
+	Language  string
+	UserAgent string
+	// Proxy is a URL of a HTTP or a SOCKS proxy, such as socks5://host:port.
+	Proxy string
+	// DownloadDir is the directory files are downloaded to, without asking.
+	DownloadDir string
+	// UserDataDir keeps the browser data between the sessions. It can not be used by two sessions at the same time.
+	UserDataDir     string
+	PageLoadTimeout time.Duration
+	ScriptTimeout   time.Duration
+}
+
+// Capabilities returns the capabilities opening a chrome session with the profile.
+func (p Profile) Capabilities() (selenium.Capabilities, error) {
+	args := []string{
+		"--no-sandbox",
+		"--disable-dev-shm-usage",
+		"disable-gpu",
+	}
+
+	if p.WindowSize != "" {
+		args = append(args, "window-size="+p.WindowSize)
+	}
+	if p.Language != "" {
+		args = append(args, "lang="+p.Language)
+	}
+	if p.UserAgent != "" {
+		args = append(args, "user-agent="+p.UserAgent)
+	}
+	if p.UserDataDir != "" {
+		args = append(args, "user-data-dir="+p.UserDataDir)
+	}
+	if p.Headless {
+		args = append(args, "--headless")
+	}
+	args = append(args, p.Args...)
+
+	prefs := map[string]interface{}{}
+	if p.Language != "" {
+		prefs["intl.accept_languages"] = p.Language
+	}
+	if p.DownloadDir != "" {
+		prefs["download.default_directory"] = p.DownloadDir
+		prefs["download.prompt_for_download"] = false
+	}
+
+	caps := selenium.Capabilities{}
+	caps.AddChrome(chrome.Capabilities{Args: args, Prefs: prefs})
+
+	if p.Proxy != "" {
+		proxy, err := parseProxy(p.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		caps.AddProxy(proxy)
+	}
+
+	return caps, nil
+}
+
+func (p Profile) applyTimeouts(wd selenium.WebDriver) error {
+	if p.PageLoadTimeout > 0 {
+		if err := wd.SetPageLoadTimeout(p.PageLoadTimeout); err != nil {
+			return errors.Wrap(err, "wd.SetPageLoadTimeout")
+		}
+	}
+
+	if p.ScriptTimeout > 0 {
+		if err := wd.SetAsyncScriptTimeout(p.ScriptTimeout); err != nil {
+			return errors.Wrap(err, "wd.SetAsyncScriptTimeout")
+		}
+	}
+
+	return nil
+}
+
+func parseProxy(rawURL string) (selenium.Proxy, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return selenium.Proxy{}, errors.Wrapf(err, "invalid proxy: %s", rawURL)
+	}
+	if u.Host == "" {
+		return selenium.Proxy{}, errors.Errorf("invalid proxy: %s", rawURL)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		return selenium.Proxy{
+			Type: selenium.Manual,
+			HTTP: u.Host,
+			SSL:  u.Host,
+		}, nil
+	case "socks4", "socks5":
+		version, _ := strconv.Atoi(u.Scheme[len("socks"):])
+		proxy := selenium.Proxy{
+			Type:         selenium.Manual,
+			SOCKS:        u.Host,
+			SOCKSVersion: version,
+		}
+		if u.User != nil {
+			proxy.SOCKSUsername = u.User.Username()
+			proxy.SOCKSPassword, _ = u.User.Password()
+		}
+		return proxy, nil
+	default:
+		return selenium.Proxy{}, errors.Errorf("unsupported proxy scheme: %s", rawURL)
+	}
+}
@@ -0,0 +1,234 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+)
+
+const reaperRequestTimeout = 10 * time.Second
+
+// Registry records the sessions opened by this process to a file, so that they are found even after a crash.
+type Registry struct {
+	path string
+
+	mu sync.Mutex
+	// owned is true for the sessions in use by this process.
+	owned map[string]bool
+}
+
+// NewRegistry loads the sessions recorded to path. They are not in use, since this process has just started.
+func NewRegistry(path string) (*Registry, error) {
+	r := &Registry{
+		path:  path,
+		owned: map[string]bool{},
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("ioutil.ReadFile(%s)", path))
+	}
+
+	var ids []string
+	if err := json.Unmarshal(b, &ids); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("json.Unmarshal(%s)", path))
+	}
+	for _, id := range ids {
+		r.owned[id] = false
+	}
+
+	return r, nil
+}
+
+// Track records the session, and returns closeFunc forgetting it once closed.
+// If it fails to close, the session is left for the Reaper.
+func (r *Registry) Track(wd selenium.WebDriver, closeFunc func() error) (func() error, error) {
+	id := wd.SessionID()
+	if err := r.set(id, true); err != nil {
+		return closeFunc, err
+	}
+
+	return func() error {
+		if err := closeFunc(); err != nil {
+			return appendErrors(err, r.set(id, false))
+		}
+
+		return r.remove(id)
+	}, nil
+}
+
+func (r *Registry) set(id string, inUse bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.owned[id] = inUse
+
+	return r.save()
+}
+
+func (r *Registry) remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.owned, id)
+
+	return r.save()
+}
+
+// unused returns the sessions owned but not in use.
+func (r *Registry) unused() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+	for id, inUse := range r.owned {
+		if !inUse {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (r *Registry) save() error {
+	ids := make([]string, 0, len(r.owned))
+	for id := range r.owned {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	// NOTE: Write to a temporary file first, not to leave a broken file if the process crashes while writing.
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("ioutil.WriteFile(%s)", tmp))
+	}
+
+	return errors.Wrap(os.Rename(tmp, r.path), "os.Rename")
+}
+
+// Reaper deletes the sessions owned by the registry but no longer in use, from the grid.
+// Otherwise they stay on the grid until SE_NODE_SESSION_TIMEOUT, and exhaust SE_NODE_MAX_SESSIONS.
+type Reaper struct {
+	host     string
+	registry *Registry
+	client   *http.Client
+}
+
+func NewReaper(host string, registry *Registry) *Reaper {
+	return &Reaper{
+		host:     strings.TrimSuffix(host, "/"),
+		registry: registry,
+		client:   &http.Client{Timeout: reaperRequestTimeout},
+	}
+}
+
+// Reap deletes the orphaned sessions, and returns the number of the deleted ones.
+// The sessions not on the grid anymore are forgotten.
+func (r *Reaper) Reap() (int, error) {
+	unused := r.registry.unused()
+	if len(unused) == 0 {
+		return 0, nil
+	}
+
+	running, err := r.gridSessions()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		reaped int
+		errs   error
+	)
+	for _, id := range unused {
+		if running[id] {
+			if err := r.deleteSession(id); err != nil {
+				errs = appendErrors(errs, err)
+				continue
+			}
+			reaped++
+		}
+
+		errs = appendErrors(errs, r.registry.remove(id))
+	}
+
+	return reaped, errs
+}
+
+type gridStatus struct {
+	Value struct {
+		Nodes []struct {
+			Slots []struct {
+				Session *struct {
+					SessionID string `json:"sessionId"`
+				} `json:"session"`
+			} `json:"slots"`
+		} `json:"nodes"`
+	} `json:"value"`
+}
+
+// gridSessions returns the sessions running on the grid, found by the status endpoint of Selenium Grid 4.
+func (r *Reaper) gridSessions() (map[string]bool, error) {
+	resp, err := r.client.Get(r.host + "/status")
+	if err != nil {
+		return nil, errors.Wrap(err, "GET /status")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET /status: %s", resp.Status)
+	}
+
+	var status gridStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, errors.Wrap(err, "json.Decode(/status)")
+	}
+
+	sessions := map[string]bool{}
+	for _, node := range status.Value.Nodes {
+		for _, slot := range node.Slots {
+			if slot.Session != nil {
+				sessions[slot.Session.SessionID] = true
+			}
+		}
+	}
+
+	return sessions, nil
+}
+
+func (r *Reaper) deleteSession(id string) error {
+	req, err := http.NewRequest(http.MethodDelete, r.host+"/session/"+id, nil)
+	if err != nil {
+		return errors.Wrap(err, "http.NewRequest")
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("DELETE /session/%s", id))
+	}
+	defer resp.Body.Close()
+
+	// NOTE: The session may have been timed out since the status was fetched.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return errors.Errorf("DELETE /session/%s: %s", id, resp.Status)
+	}
+
+	return nil
+}
@@ -2,15 +2,17 @@ package driver
 
 import (
 	"fmt"
+	"net"
 	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/tebeka/selenium"
-	"github.com/tebeka/selenium/chrome"
+
+	"github.com/Kcrong/autostudy/pkg/failure"
 )
 
 const (
-	defaultDriverServicePort = 4444
+	driverServiceAttempts = 3
 )
 
 type WaitFuncType func(selenium.Condition) error
@@ -20,28 +22,71 @@ type InitOption struct {
 	LocalBrowserPath string
 }
 
-func Init(path string, shouldRunHeadless bool, opt *InitOption) (selenium.WebDriver, func() error, error) {
+// Init opens a new session connecting to path.
+// If opt.ShouldRunService is set, a chromedriver service is started on a free port and connected instead,
+// so that multiple local sessions can coexist.
+func Init(path string, profile Profile, opt *InitOption) (selenium.WebDriver, func() error, error) {
 	closeFunc := func() error { return nil }
 
 	if opt != nil && opt.ShouldRunService {
-		service, err := selenium.NewChromeDriverService(opt.LocalBrowserPath, defaultDriverServicePort)
+		service, port, err := startDriverService(opt.LocalBrowserPath)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "selenium.NewChromeDriverService")
+			return nil, nil, failure.Wrap(err, failure.ErrDriverUnavailable)
 		}
 
 		closeFunc = appendFunc(service.Stop, closeFunc)
+		path = fmt.Sprintf("http://localhost:%d/wd/hub", port)
 	}
 
-	driver, err := selenium.NewRemote(defaultChromeCaps(shouldRunHeadless), path)
+	caps, err := profile.Capabilities()
 	if err != nil {
-		return nil, closeFunc, errors.Wrap(err, "selenium.NewRemote")
+		return nil, closeFunc, err
+	}
+
+	driver, err := selenium.NewRemote(caps, path)
+	if err != nil {
+		return nil, closeFunc, failure.Wrap(errors.Wrap(err, "selenium.NewRemote"), failure.ErrDriverUnavailable)
 	}
 
 	closeFunc = appendFunc(driver.Quit, closeFunc)
 
+	if err := profile.applyTimeouts(driver); err != nil {
+		return nil, closeFunc, err
+	}
+
 	return driver, closeFunc, nil
 }
 
+func startDriverService(browserPath string) (*selenium.Service, int, error) {
+	var err error
+	// NOTE: The port can be taken by another process between found and used, so try again with another one.
+	for attempt := 0; attempt < driverServiceAttempts; attempt++ {
+		var port int
+		if port, err = freePort(); err != nil {
+			continue
+		}
+
+		var service *selenium.Service
+		if service, err = selenium.NewChromeDriverService(browserPath, port); err == nil {
+			return service, port, nil
+		}
+		err = errors.Wrap(err, "selenium.NewChromeDriverService")
+	}
+
+	return nil, 0, err
+}
+
+// freePort returns a port not used at the moment, chosen by the OS.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, errors.Wrap(err, "net.Listen")
+	}
+	defer l.Close()
+
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
 // AssertUrl is asserting that the driver located at the given url.
 func AssertUrl(url string, wd selenium.WebDriver) error {
 	currentUrl, err := wd.CurrentURL()
@@ -60,10 +105,19 @@ func AssertUrl(url string, wd selenium.WebDriver) error {
 }
 
 func WaitElement(wd selenium.WebDriver, by, selector string) error {
-	return errors.Wrap(wd.Wait(func(wd selenium.WebDriver) (bool, error) {
-		_, err := wd.FindElement(by, selector)
-		return err == nil, nil
-	}), "wd.WaitElement")
+	var findErr error
+	if err := wd.Wait(func(wd selenium.WebDriver) (bool, error) {
+		_, findErr = wd.FindElement(by, selector)
+		return findErr == nil, nil
+	}); err != nil {
+		// NOTE: Return the error of the last lookup, so that a missing element can be told from the other failures.
+		if findErr != nil {
+			err = findErr
+		}
+		return errors.Wrap(err, "wd.WaitElement")
+	}
+
+	return nil
 }
 
 func WaitAndFindElement(wd selenium.WebDriver, by, selector string) (selenium.WebElement, error) {
@@ -75,44 +129,52 @@ func WaitAndFindElement(wd selenium.WebDriver, by, selector string) (selenium.We
 }
 
 func IsNoSuchElementError(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	err, ok := err.(*selenium.Error)
-	if !ok {
-		return false
-	}
-
-	return err.(*selenium.Error).Err == "no such element"
+	return hasSeleniumError(err, "no such element")
 }
 
+// appendFunc returns a function running every func, even if some of them fail.
 func appendFunc(funcs ...func() error) func() error {
 	return func() error {
+		var errs error
 		for _, f := range funcs {
-			if err := f(); err != nil {
-				return err
-			}
+			errs = appendErrors(errs, f())
 		}
 
-		return nil
+		return errs
 	}
 }
 
-func defaultChromeCaps(shouldHeadless bool) selenium.Capabilities {
-	args := []string{
-		"window-size=1920x1080",
-		"--no-sandbox",
-		"--disable-dev-shm-usage",
-		"disable-gpu",
-		"user-agent=Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.87 Safari/537.36",
+// multiError is the errors of the steps which should all run, such as closing a session.
+type multiError []error
+
+func (m multiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
 	}
 
-	if shouldHeadless {
-		args = append(args, "--headless")
+	return strings.Join(msgs, "; ")
+}
+
+// appendErrors merges the errors ignoring nil ones. It returns nil if every error is nil.
+func appendErrors(errs ...error) error {
+	var merged multiError
+	for _, err := range errs {
+		switch err := err.(type) {
+		case nil:
+		case multiError:
+			merged = append(merged, err...)
+		default:
+			merged = append(merged, err)
+		}
 	}
 
-	caps := selenium.Capabilities{}
-	caps.AddChrome(chrome.Capabilities{Args: args})
-	return caps
+	switch len(merged) {
+	case 0:
+		return nil
+	case 1:
+		return merged[0]
+	default:
+		return merged
+	}
 }
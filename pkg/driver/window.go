@@ -0,0 +1,126 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+)
+
+// WindowTracker finds the window opened by an action, and restores the main window afterwards.
+type WindowTracker struct {
+	wd     selenium.WebDriver
+	main   string
+	before map[string]bool
+}
+
+// TrackWindows records the current window as the main one, and closes the other windows left by a previous failure,
+// so that they are not taken for the one opened next.
+func TrackWindows(wd selenium.WebDriver) (*WindowTracker, error) {
+	main, err := wd.CurrentWindowHandle()
+	if err != nil {
+		// NOTE: The current window may have been closed. Take the first one left.
+		handles, handlesErr := wd.WindowHandles()
+		if handlesErr != nil || len(handles) == 0 {
+			return nil, errors.Wrap(err, "wd.CurrentWindowHandle()")
+		}
+		main = handles[0]
+	}
+
+	t := &WindowTracker{wd: wd, main: main}
+	if err := t.Restore(); err != nil {
+		return nil, err
+	}
+
+	handles, err := wd.WindowHandles()
+	if err != nil {
+		return nil, errors.Wrap(err, "wd.WindowHandles()")
+	}
+	t.before = make(map[string]bool, len(handles))
+	for _, h := range handles {
+		t.before[h] = true
+	}
+
+	return t, nil
+}
+
+// WindowMatchFuncType reports whether the window the driver is switched to is the one waited for.
+type WindowMatchFuncType func(wd selenium.WebDriver) (bool, error)
+
+// WaitNew waits until timeout for a window opened since TrackWindows which matchFunc matches, and switches to it.
+// The windows opened are checked until one matches, since another window such as a notice popup can be opened first,
+// and the window waited for can take a while to show what matchFunc looks for.
+// The other windows opened are closed.
+func (t *WindowTracker) WaitNew(timeout time.Duration, matchFunc WindowMatchFuncType) (string, error) {
+	var matched string
+	if err := t.wd.WaitWithTimeout(func(wd selenium.WebDriver) (bool, error) {
+		handles, err := wd.WindowHandles()
+		if err != nil {
+			return false, errors.Wrap(err, "wd.WindowHandles()")
+		}
+
+		for _, h := range handles {
+			if t.before[h] {
+				continue
+			}
+			if err := wd.SwitchWindow(h); err != nil {
+				// NOTE: The window may have been closed by itself.
+				continue
+			}
+
+			ok, err := matchFunc(wd)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				matched = h
+				return true, nil
+			}
+		}
+		return false, nil
+	}, timeout); err != nil {
+		return "", errors.Wrapf(err, "no window matched in %s", timeout)
+	}
+
+	handles, err := t.wd.WindowHandles()
+	if err != nil {
+		return "", errors.Wrap(err, "wd.WindowHandles()")
+	}
+	for _, h := range handles {
+		if t.before[h] || h == matched {
+			continue
+		}
+		if err := t.close(h); err != nil {
+			return "", err
+		}
+	}
+
+	return matched, errors.Wrap(t.wd.SwitchWindow(matched), "wd.SwitchWindow(matched)")
+}
+
+// Restore closes every window but the main one, and switches to the main one.
+func (t *WindowTracker) Restore() error {
+	handles, err := t.wd.WindowHandles()
+	if err != nil {
+		return errors.Wrap(err, "wd.WindowHandles()")
+	}
+
+	for _, h := range handles {
+		if h == t.main {
+			continue
+		}
+		if err := t.close(h); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(t.wd.SwitchWindow(t.main), "wd.SwitchWindow(main)")
+}
+
+func (t *WindowTracker) close(handle string) error {
+	if err := t.wd.SwitchWindow(handle); err != nil {
+		return errors.Wrap(err, "wd.SwitchWindow(handle)")
+	}
+
+	return errors.Wrap(t.wd.Close(), "wd.Close()")
+}
@@ -0,0 +1,167 @@
+package failure
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Action is how the caller should react to a failure.
+type Action int
+
+const (
+	// ActionAbort stops the run.
+	ActionAbort Action = iota
+	// ActionRetry tries the step again.
+	ActionRetry
+	// ActionSkip gives up the lecture and continues the run with the others.
+	ActionSkip
+	// ActionPage stops the run and asks a human to fix it.
+	ActionPage
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionAbort:
+		return "abort"
+	case ActionRetry:
+		return "retry"
+	case ActionSkip:
+		return "skip"
+	case ActionPage:
+		return "page"
+	default:
+		return "unknown"
+	}
+}
+
+// Kind is a sentinel error classifying failures. Check it with errors.Is.
+type Kind struct {
+	Name string
+	// Hint tells a human how to fix the failure.
+	Hint   string
+	Action Action
+}
+
+func (k *Kind) Error() string {
+	return k.Name
+}
+
+var (
+	ErrLoginFailed = &Kind{
+		Name:   "login failed",
+		Hint:   "Log in to the LMS by hand, then check UNIV_ID and UNIV_PW.",
+		Action: ActionPage,
+	}
+	ErrSessionExpired = &Kind{
+		Name:   "session expired",
+		Hint:   "The LMS logged the session out. It is logged in again automatically; check the login if it keeps failing.",
+		Action: ActionRetry,
+	}
+	ErrLayoutChanged = &Kind{
+		Name:   "layout changed",
+		Hint:   "The LMS page may have been redesigned. Compare the screenshot with the selectors in pkg/univ.",
+		Action: ActionPage,
+	}
+	ErrPlayerTimeout = &Kind{
+		Name:   "player timeout",
+		Hint:   "The player did not finish in time. Watch the lecture by hand if it keeps failing.",
+		Action: ActionSkip,
+	}
+	ErrUnsupportedContent = &Kind{
+		Name:   "unsupported content",
+		Hint:   "The lecture has a type of content which can not be completed automatically. Complete it by hand.",
+		Action: ActionSkip,
+	}
+	ErrNotCredited = &Kind{
+		Name:   "not credited",
+		Hint:   "The lecture was played, but the LMS did not record it. Check the lecture page if it keeps failing.",
+		Action: ActionRetry,
+	}
+	ErrDialogAborted = &Kind{
+		Name:   "dialog aborted",
+		Hint:   "An alert of the LMS matched an abort rule of DIALOG_RULES. Read the alert, then fix the rule or the account.",
+		Action: ActionAbort,
+	}
+	ErrDriverUnavailable = &Kind{
+		Name:   "driver unavailable",
+		Hint:   "Check SELENIUM_WEB_DRIVER_HOST, and that the grid is up with free sessions.",
+		Action: ActionAbort,
+	}
+	ErrNotifierFailed = &Kind{
+		Name:   "notifier failed",
+		Hint:   "Check TELEGRAM_API_TOKEN and TELEGRAM_CHAT_ID, and the network to telegram.",
+		Action: ActionAbort,
+	}
+)
+
+// Classified is an error belonging to a Kind.
+type Classified interface {
+	error
+	Kind() *Kind
+}
+
+type classified struct {
+	kind  *Kind
+	cause error
+}
+
+func (c *classified) Error() string {
+	return c.kind.Name + ": " + c.cause.Error()
+}
+
+func (c *classified) Kind() *Kind {
+	return c.kind
+}
+
+func (c *classified) Is(target error) bool {
+	return target == c.kind
+}
+
+func (c *classified) Unwrap() error {
+	return c.cause
+}
+
+func (c *classified) Cause() error {
+	return c.cause
+}
+
+// Wrap classifies err as kind. It returns nil if err is nil, and err itself if it is already classified.
+func Wrap(err error, kind *Kind) error {
+	if err == nil || KindOf(err) != nil {
+		return err
+	}
+
+	return &classified{kind: kind, cause: err}
+}
+
+// KindOf returns the kind of err, or nil if err is not classified.
+func KindOf(err error) *Kind {
+	var k *Kind
+	if errors.As(err, &k) {
+		return k
+	}
+
+	var c Classified
+	if errors.As(err, &c) {
+		return c.Kind()
+	}
+
+	return nil
+}
+
+// Hint returns the hint of the kind of err, or an empty string if err is not classified.
+func Hint(err error) string {
+	if k := KindOf(err); k != nil {
+		return k.Hint
+	}
+
+	return ""
+}
+
+// ActionOf returns the action for err. Errors not classified are assumed to be transient, and retried.
+func ActionOf(err error) Action {
+	if k := KindOf(err); k != nil {
+		return k.Action
+	}
+
+	return ActionRetry
+}
@@ -0,0 +1,116 @@
+package noti
+
+import (
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+
+	"github.com/Kcrong/autostudy/pkg/failure"
+)
+
+// ErrNoAnswer is returned by Ask if no owner answered in time.
+var ErrNoAnswer = errors.New("no answer")
+
+// Ask sends the question, and waits for an owner to reply to it until timeout.
+// The replies are only received from the updates passed through Intercept.
+func (r *Router) Ask(question string, timeout time.Duration) (string, error) {
+	m := tgbotapi.NewMessage(r.bot.chatID, question)
+	m.ReplyMarkup = tgbotapi.ForceReply{ForceReply: true}
+	sent, err := r.bot.bot.Send(m)
+	if err != nil {
+		return "", failure.Wrap(errors.Wrap(err, "b.bot.Send(tgbotapi.NewMessage(b.chatID, question))"), failure.ErrNotifierFailed)
+	}
+
+	answer := make(chan string, 1)
+
+	r.questionsMu.Lock()
+	r.questions[sent.MessageID] = answer
+	r.questionsMu.Unlock()
+
+	defer func() {
+		r.questionsMu.Lock()
+		delete(r.questions, sent.MessageID)
+		r.questionsMu.Unlock()
+	}()
+
+	select {
+	case text := <-answer:
+		return text, nil
+	case <-time.After(timeout):
+		// NOTE: Even if fails to notify, the question has expired.
+		_ = r.bot.SendMessage("No answer in " + timeout.String() + ": " + question)
+		return "", errors.Wrap(ErrNoAnswer, question)
+	}
+}
+
+// Intercept takes the answers to the questions of Ask out of updates, and passes the rest through.
+// Dispatch the returned updates, so that questions are answered even while a command is handled.
+func (r *Router) Intercept(updates tgbotapi.UpdatesChannel) tgbotapi.UpdatesChannel {
+	out := make(chan tgbotapi.Update)
+
+	go func() {
+		defer close(out)
+
+		// NOTE: Queue the updates without limit, not to block the answers behind a long command.
+		var pending []tgbotapi.Update
+		in := updates
+		for in != nil || len(pending) > 0 {
+			var (
+				send chan<- tgbotapi.Update
+				next tgbotapi.Update
+			)
+			if len(pending) > 0 {
+				send, next = out, pending[0]
+			}
+
+			select {
+			case update, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				if !r.answer(update) {
+					pending = append(pending, update)
+				}
+			case send <- next:
+				pending = pending[1:]
+			}
+		}
+	}()
+
+	return out
+}
+
+// answer delivers the message to the question it replies to.
+// A message not replying to anything answers the question if only one is waiting.
+func (r *Router) answer(update tgbotapi.Update) bool {
+	m := update.Message
+	if m == nil || m.IsCommand() || m.Chat == nil || m.Chat.ID != r.bot.chatID || !r.hasRole(m.From, RoleOwner) {
+		return false
+	}
+
+	r.questionsMu.Lock()
+	defer r.questionsMu.Unlock()
+
+	var (
+		questionID int
+		answer     chan string
+	)
+	if m.ReplyToMessage != nil {
+		questionID = m.ReplyToMessage.MessageID
+		answer = r.questions[questionID]
+	} else if len(r.questions) == 1 {
+		for id, ch := range r.questions {
+			questionID, answer = id, ch
+		}
+	}
+	if answer == nil {
+		return false
+	}
+
+	delete(r.questions, questionID)
+	answer <- m.Text
+
+	return true
+}
@@ -0,0 +1,215 @@
+package noti
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	progressBarWidth = 20
+	// progressPlaybackInterval is the least interval between the edits by playback updates,
+	// not to hit the edit rate limit of telegram with several sessions playing.
+	progressPlaybackInterval = 5 * time.Second
+)
+
+type lectureProgress struct {
+	title    string
+	current  time.Duration
+	duration time.Duration
+}
+
+// Progress is a single telegram message which is edited as the run goes on.
+// It is safe to update from multiple sessions watching lectures at the same time.
+type Progress struct {
+	bot       TelegramBot
+	messageID int
+	startedAt time.Time
+
+	mu       sync.Mutex
+	total    int
+	done     int
+	failed   int
+	keys     []string
+	lectures map[string]*lectureProgress
+	finished bool
+	lastText string
+	editedAt time.Time
+}
+
+// NewProgress sends the initial progress message of a run which will process total lectures.
+func (b TelegramBot) NewProgress(total int) (*Progress, error) {
+	p := &Progress{
+		bot:       b,
+		startedAt: b.nowFunc(),
+		total:     total,
+		lectures:  map[string]*lectureProgress{},
+	}
+
+	text := p.render()
+	messageID, err := b.sendMessage(text)
+	if err != nil {
+		return nil, err
+	}
+
+	p.messageID = messageID
+	p.lastText = text
+
+	return p, nil
+}
+
+// StartLecture marks the lecture identified by key as currently processed.
+func (p *Progress) StartLecture(key, title string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.lectures[key]; !ok {
+		p.keys = append(p.keys, key)
+	}
+	p.lectures[key] = &lectureProgress{title: title}
+
+	return p.flush()
+}
+
+// UpdatePlayback updates the playback location of the lecture.
+func (p *Progress) UpdatePlayback(key string, current, duration time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l, ok := p.lectures[key]
+	if !ok {
+		return nil
+	}
+	l.current, l.duration = current, duration
+
+	// NOTE: The playback skipped here is shown by the next edit.
+	if p.bot.nowFunc().Sub(p.editedAt) < progressPlaybackInterval {
+		return nil
+	}
+
+	return p.flush()
+}
+
+// CompleteLecture counts the lecture as done.
+func (p *Progress) CompleteLecture(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	p.remove(key)
+
+	return p.flush()
+}
+
+// StopLecture removes the lecture from the ones in progress without counting it,
+// so that it can be started again, or counted by FailLecture.
+func (p *Progress) StopLecture(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.remove(key)
+
+	return p.flush()
+}
+
+// FailLecture counts the lecture as failed.
+func (p *Progress) FailLecture(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.failed++
+	p.remove(key)
+
+	return p.flush()
+}
+
+// Finish marks the run as finished.
+func (p *Progress) Finish() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finished = true
+	p.keys = nil
+	p.lectures = map[string]*lectureProgress{}
+
+	return p.flush()
+}
+
+func (p *Progress) remove(key string) {
+	delete(p.lectures, key)
+	for i, k := range p.keys {
+		if k == key {
+			p.keys = append(p.keys[:i:i], p.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (p *Progress) flush() error {
+	text := p.render()
+	// NOTE: Telegram rejects edits which do not change the message.
+	if text == p.lastText {
+		return nil
+	}
+
+	if err := p.bot.EditMessage(p.messageID, text); err != nil {
+		return err
+	}
+	p.lastText = text
+	p.editedAt = p.bot.nowFunc()
+
+	return nil
+}
+
+func (p *Progress) render() string {
+	var sb strings.Builder
+
+	if p.finished {
+		sb.WriteString("Run finished")
+	} else {
+		sb.WriteString("Run in progress")
+	}
+	sb.WriteString("\n")
+
+	for _, key := range p.keys {
+		l := p.lectures[key]
+		sb.WriteString("Lecture: " + l.title)
+		sb.WriteString("\n")
+		sb.WriteString(progressBar(l.current, l.duration))
+		sb.WriteString("\n")
+	}
+
+	remaining := p.total - p.done - p.failed
+	if remaining < 0 {
+		remaining = 0
+	}
+	sb.WriteString(fmt.Sprintf("Done: %d, Failed: %d, Remaining: %d", p.done, p.failed, remaining))
+	sb.WriteString("\n")
+	sb.WriteString("Elapsed: " + p.bot.nowFunc().Sub(p.startedAt).Truncate(time.Second).String())
+
+	return sb.String()
+}
+
+func progressBar(current, duration time.Duration) string {
+	ratio := 0.0
+	if duration > 0 {
+		ratio = float64(current) / float64(duration)
+	}
+	if ratio > 1 {
+		ratio = 1
+	}
+
+	filled := int(ratio * progressBarWidth)
+
+	return fmt.Sprintf(
+		"[%s%s] %.0f%% (%s / %s)",
+		strings.Repeat("█", filled), strings.Repeat("░", progressBarWidth-filled),
+		ratio*100, formatClock(current), formatClock(duration),
+	)
+}
+
+func formatClock(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
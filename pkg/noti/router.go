@@ -0,0 +1,251 @@
+package noti
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	CommandHelp = "help"
+
+	callbackDataSeparator = ":"
+
+	keyboardRowSize = 3
+)
+
+type Role int
+
+const (
+	// RoleMember is anyone who sends messages in the configured chat.
+	RoleMember Role = iota
+	// RoleOwner is a member listed as an owner.
+	RoleOwner
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleMember:
+		return "member"
+	case RoleOwner:
+		return "owner"
+	default:
+		return "unknown"
+	}
+}
+
+// Request is a command message routed to a Command.
+type Request struct {
+	Message *tgbotapi.Message
+	// Args is the value returned by Command.ParseArgs. nil if the command has no parser.
+	Args interface{}
+}
+
+type HandlerFuncType func(Request) error
+
+// ArgsParserFuncType parses the text after the command.
+type ArgsParserFuncType func(args string) (interface{}, error)
+
+// CallbackRequest is a callback query of an inline keyboard routed to Command.Callback.
+type CallbackRequest struct {
+	Query *tgbotapi.CallbackQuery
+	// Data is the payload given to CallbackData.
+	Data string
+}
+
+type CallbackHandlerFuncType func(CallbackRequest) error
+
+// CallbackData returns the data of an inline keyboard button routed to Command.Callback of the command.
+func CallbackData(command, payload string) string {
+	return command + callbackDataSeparator + payload
+}
+
+type Command struct {
+	// Name is the command without TelegramCommandPrefix.
+	Name        string
+	Description string
+	// Usage describes the arguments, e.g. "<subject>".
+	Usage     string
+	Role      Role
+	ParseArgs ArgsParserFuncType
+	Handler   HandlerFuncType
+	// Callback handles the inline keyboard buttons made with CallbackData(Name, ...).
+	Callback CallbackHandlerFuncType
+}
+
+func (c Command) help() string {
+	line := TelegramCommandPrefix + c.Name
+	if c.Usage != "" {
+		line += " " + c.Usage
+	}
+
+	return line + " - " + c.Description
+}
+
+// Router dispatches command messages to the registered commands.
+type Router struct {
+	bot      *TelegramBot
+	ownerIDs []int64
+
+	commands []Command
+	byName   map[string]Command
+
+	questionsMu sync.Mutex
+	// questions are the answers waited by Ask, keyed by the message ID of the question.
+	questions map[int]chan string
+}
+
+// NewRouter returns a router with the help command registered.
+// If ownerIDs is empty, every member is treated as an owner.
+func NewRouter(bot *TelegramBot, ownerIDs []int64) *Router {
+	r := &Router{
+		bot:       bot,
+		ownerIDs:  ownerIDs,
+		byName:    map[string]Command{},
+		questions: map[int]chan string{},
+	}
+
+	help := Command{
+		Name:        CommandHelp,
+		Description: "Show available commands",
+		Role:        RoleMember,
+		Handler: func(Request) error {
+			return r.bot.SendMessage(r.help())
+		},
+	}
+	r.commands = append(r.commands, help)
+	r.byName[help.Name] = help
+
+	return r
+}
+
+// Register adds the commands, then updates the bot menu and the reply keyboard.
+func (r *Router) Register(commands ...Command) error {
+	for _, c := range commands {
+		if c.Name == "" || c.Handler == nil {
+			return errors.Errorf("invalid command: %q", c.Name)
+		}
+		if _, ok := r.byName[c.Name]; ok {
+			return errors.Errorf("command already registered: %s", c.Name)
+		}
+
+		r.commands = append(r.commands, c)
+		r.byName[c.Name] = c
+	}
+
+	botCommands := make([]tgbotapi.BotCommand, len(r.commands))
+	for i, c := range r.commands {
+		botCommands[i] = tgbotapi.BotCommand{
+			Command:     c.Name,
+			Description: c.Description,
+		}
+	}
+	if _, err := r.bot.bot.Request(tgbotapi.NewSetMyCommands(botCommands...)); err != nil {
+		return errors.Wrap(err, "r.bot.bot.Request(tgbotapi.NewSetMyCommands(botCommands...))")
+	}
+
+	r.bot.keyboard = r.keyboard()
+
+	return nil
+}
+
+// Dispatch runs the handler of the command or the callback query in the update.
+// Updates which are not commands, or not sent in the configured chat, are ignored.
+func (r *Router) Dispatch(update tgbotapi.Update) error {
+	if update.CallbackQuery != nil {
+		return r.dispatchCallback(update.CallbackQuery)
+	}
+
+	m := update.Message
+	if m == nil || !m.IsCommand() || m.Chat == nil || m.Chat.ID != r.bot.chatID {
+		return nil
+	}
+
+	c, ok := r.byName[m.Command()]
+	if !ok {
+		return r.bot.SendMessage("Unknown command: " + TelegramCommandPrefix + m.Command() + "\n" + r.help())
+	}
+
+	if !r.hasRole(m.From, c.Role) {
+		return r.bot.SendMessage("Permission denied: " + TelegramCommandPrefix + c.Name + " requires " + c.Role.String())
+	}
+
+	req := Request{Message: m}
+	if c.ParseArgs != nil {
+		args, err := c.ParseArgs(strings.TrimSpace(m.CommandArguments()))
+		if err != nil {
+			return r.bot.SendMessage(err.Error() + "\n" + "Usage: " + c.help())
+		}
+		req.Args = args
+	}
+
+	return c.Handler(req)
+}
+
+func (r *Router) dispatchCallback(q *tgbotapi.CallbackQuery) error {
+	if q.Message == nil || q.Message.Chat == nil || q.Message.Chat.ID != r.bot.chatID {
+		return nil
+	}
+
+	// Stop the loading indicator of the button.
+	if _, err := r.bot.bot.Request(tgbotapi.NewCallback(q.ID, "")); err != nil {
+		return errors.Wrap(err, "r.bot.bot.Request(tgbotapi.NewCallback(q.ID, \"\"))")
+	}
+
+	name, payload, _ := strings.Cut(q.Data, callbackDataSeparator)
+	c, ok := r.byName[name]
+	if !ok || c.Callback == nil {
+		return nil
+	}
+
+	if !r.hasRole(q.From, c.Role) {
+		return r.bot.SendMessage("Permission denied: " + TelegramCommandPrefix + c.Name + " requires " + c.Role.String())
+	}
+
+	return c.Callback(CallbackRequest{
+		Query: q,
+		Data:  payload,
+	})
+}
+
+func (r *Router) hasRole(user *tgbotapi.User, role Role) bool {
+	if role == RoleMember || len(r.ownerIDs) == 0 {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+
+	for _, id := range r.ownerIDs {
+		if user.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Router) help() string {
+	lines := make([]string, len(r.commands))
+	for i, c := range r.commands {
+		lines[i] = c.help()
+	}
+	sort.Strings(lines)
+
+	return strings.Join(lines, "\n")
+}
+
+func (r *Router) keyboard() tgbotapi.ReplyKeyboardMarkup {
+	var rows [][]tgbotapi.KeyboardButton
+	for i, c := range r.commands {
+		if i%keyboardRowSize == 0 {
+			rows = append(rows, []tgbotapi.KeyboardButton{})
+		}
+		rows[len(rows)-1] = append(rows[len(rows)-1], tgbotapi.NewKeyboardButton(TelegramCommandPrefix+c.Name))
+	}
+
+	return tgbotapi.NewReplyKeyboard(rows...)
+}
@@ -5,54 +5,54 @@ import (
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/pkg/errors"
+
+	"github.com/Kcrong/autostudy/pkg/failure"
 )
 
 const (
 	TelegramCommandPrefix = "/"
-
-	CommandReport = "report"
-	CommandRun    = "run"
-)
-
-var (
-	validCommands = []string{CommandReport, CommandRun}
 )
 
-func IsValidCommand(c string) bool {
-	for _, validCommand := range validCommands {
-		if c == validCommand {
-			return true
-		}
-	}
-	return false
+type TelegramBot struct {
+	bot      *tgbotapi.BotAPI
+	chatID   int64
+	nowFunc  func() time.Time
+	keyboard interface{}
 }
 
-var (
-	keyboardMarkup = func() tgbotapi.ReplyKeyboardMarkup {
-		rows := make([]tgbotapi.KeyboardButton, len(validCommands))
-		for i, c := range validCommands {
-			rows[i] = tgbotapi.NewKeyboardButton(TelegramCommandPrefix + c)
-		}
+func (b TelegramBot) SendMessage(msg string) error {
+	_, err := b.sendMessage(msg)
+	return err
+}
 
-		return tgbotapi.NewReplyKeyboard(
-			tgbotapi.NewKeyboardButtonRow(
-				rows...,
-			),
-		)
-	}()
-)
+func (b TelegramBot) sendMessage(msg string) (int, error) {
+	m := tgbotapi.NewMessage(b.chatID, msg)
+	m.ReplyMarkup = b.keyboard
+	sent, err := b.bot.Send(m)
+	return sent.MessageID, failure.Wrap(errors.Wrap(err, "b.bot.Send(tgbotapi.NewMessage(b.chatID, msg))"), failure.ErrNotifierFailed)
+}
 
-type TelegramBot struct {
-	bot     *tgbotapi.BotAPI
-	chatID  int64
-	nowFunc func() time.Time
+// EditMessage replaces the text of the message sent before.
+func (b TelegramBot) EditMessage(messageID int, msg string) error {
+	_, err := b.bot.Send(tgbotapi.NewEditMessageText(b.chatID, messageID, msg))
+	return failure.Wrap(errors.Wrap(err, "b.bot.Send(tgbotapi.NewEditMessageText(b.chatID, messageID, msg))"), failure.ErrNotifierFailed)
 }
 
-func (b TelegramBot) SendMessage(msg string) error {
+// SendInlineKeyboard sends the message with the inline keyboard instead of the command keyboard.
+func (b TelegramBot) SendInlineKeyboard(msg string, markup tgbotapi.InlineKeyboardMarkup) error {
 	m := tgbotapi.NewMessage(b.chatID, msg)
-	m.ReplyMarkup = keyboardMarkup
+	m.ReplyMarkup = markup
+	_, err := b.bot.Send(m)
+	return failure.Wrap(errors.Wrap(err, "b.bot.Send(tgbotapi.NewMessage(b.chatID, msg))"), failure.ErrNotifierFailed)
+}
+
+// EditInlineKeyboard replaces the text and the inline keyboard of the message.
+// The keyboard is removed if markup is nil.
+func (b TelegramBot) EditInlineKeyboard(messageID int, msg string, markup *tgbotapi.InlineKeyboardMarkup) error {
+	m := tgbotapi.NewEditMessageText(b.chatID, messageID, msg)
+	m.ReplyMarkup = markup
 	_, err := b.bot.Send(m)
-	return errors.Wrap(err, "b.bot.Send(tgbotapi.NewMessage(b.chatID, msg))")
+	return failure.Wrap(errors.Wrap(err, "b.bot.Send(tgbotapi.NewEditMessageText(b.chatID, messageID, msg))"), failure.ErrNotifierFailed)
 }
 
 func (b TelegramBot) SendPhoto(photo []byte) error {
@@ -60,9 +60,9 @@ func (b TelegramBot) SendPhoto(photo []byte) error {
 		Name:  b.nowFunc().String() + ".png",
 		Bytes: photo,
 	})
-	m.ReplyMarkup = keyboardMarkup
+	m.ReplyMarkup = b.keyboard
 	_, err := b.bot.Send(m)
-	return errors.Wrap(err, "b.bot.Send(tgbotapi.NewPhoto(b.chatID, tgbotapi.FileBytes{...}))")
+	return failure.Wrap(errors.Wrap(err, "b.bot.Send(tgbotapi.NewPhoto(b.chatID, tgbotapi.FileBytes{...}))"), failure.ErrNotifierFailed)
 }
 
 func (b TelegramBot) Updates() tgbotapi.UpdatesChannel {
@@ -0,0 +1,125 @@
+package noti
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// SecretTokenHeader is the header telegram sets to the secret_token given to setWebhook.
+const SecretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+const (
+	webhookTimeout         = 10 * time.Second
+	webhookShutdownTimeout = 30 * time.Second
+)
+
+type WebhookOption struct {
+	ListenAddr  string
+	Path        string
+	SecretToken string
+	// PublicURL is registered via setWebhook if not empty.
+	// Leave it empty if the webhook is registered elsewhere, e.g. by the reverse proxy setup.
+	PublicURL string
+}
+
+// NewWebhookHandler returns a http.Handler which decodes telegram updates and sends them to updates.
+// Requests without the matching secret token header are rejected.
+// NOTE: The handler never blocks. If updates is full, the update is dropped but still acknowledged,
+// since telegram delivers it again if not acknowledged in time, duplicating the ones queued meanwhile.
+func NewWebhookHandler(secretToken string, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get(SecretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secretToken)) != 1 {
+			http.Error(w, "invalid secret token", http.StatusUnauthorized)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- update:
+		default:
+			log.Warnf("dropped the telegram update %d, since the updates are full", update.UpdateID)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// ListenWebhook starts a http server receiving updates on opt.Path, until ctx is done.
+// The returned channel can be used in place of Updates. It is closed when the server stops, after its handlers returned.
+func (b TelegramBot) ListenWebhook(ctx context.Context, opt WebhookOption) (tgbotapi.UpdatesChannel, error) {
+	if opt.PublicURL != "" {
+		if err := b.setWebhook(opt.PublicURL, opt.SecretToken); err != nil {
+			return nil, err
+		}
+	}
+
+	updates := make(chan tgbotapi.Update, b.bot.Buffer)
+
+	mux := http.NewServeMux()
+	mux.Handle(opt.Path, NewWebhookHandler(opt.SecretToken, updates))
+
+	listener, err := net.Listen("tcp", opt.ListenAddr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "net.Listen(tcp, %s)", opt.ListenAddr)
+	}
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: webhookTimeout,
+		ReadTimeout:       webhookTimeout,
+		WriteTimeout:      webhookTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case err := <-serveErr:
+			if err != http.ErrServerClosed {
+				log.Errorf("%+v", errors.Wrap(err, "server.Serve"))
+			}
+		}
+
+		// NOTE: Wait for the handlers sending to updates, before closing it.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), webhookShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("%+v", errors.Wrap(err, "server.Shutdown"))
+			return
+		}
+		close(updates)
+	}()
+
+	return updates, nil
+}
+
+func (b TelegramBot) setWebhook(url, secretToken string) error {
+	params := tgbotapi.Params{}
+	params.AddNonEmpty("url", url)
+	params.AddNonEmpty("secret_token", secretToken)
+
+	_, err := b.bot.MakeRequest("setWebhook", params)
+	return errors.Wrap(err, "b.bot.MakeRequest(setWebhook)")
+}
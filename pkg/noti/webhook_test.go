@@ -0,0 +1,120 @@
+package noti
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const testSecretToken = "secret"
+
+func TestWebhookHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		token  string
+		body   string
+		status int
+	}{
+		{name: "wrong secret", method: http.MethodPost, token: "wrong", body: `{"update_id": 1}`, status: http.StatusUnauthorized},
+		{name: "no secret", method: http.MethodPost, body: `{"update_id": 1}`, status: http.StatusUnauthorized},
+		{name: "not post", method: http.MethodGet, token: testSecretToken, status: http.StatusMethodNotAllowed},
+		{name: "bad body", method: http.MethodPost, token: testSecretToken, body: `{"update_id":`, status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates := make(chan tgbotapi.Update, 1)
+			rec := serveWebhook(NewWebhookHandler(testSecretToken, updates), tt.method, tt.token, tt.body)
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if len(updates) != 0 {
+				t.Errorf("delivered %d updates, want none", len(updates))
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerDelivers(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	rec := serveWebhook(NewWebhookHandler(testSecretToken, updates), http.MethodPost, testSecretToken,
+		`{"update_id": 7, "message": {"message_id": 3, "text": "/report"}}`)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	select {
+	case update := <-updates:
+		if update.UpdateID != 7 || update.Message == nil || update.Message.Text != "/report" {
+			t.Errorf("delivered %+v, want the update 7 of /report", update)
+		}
+	default:
+		t.Fatal("no update delivered")
+	}
+}
+
+func TestWebhookHandlerDropsWhenFull(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	updates <- tgbotapi.Update{UpdateID: 1}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- serveWebhook(NewWebhookHandler(testSecretToken, updates), http.MethodPost, testSecretToken, `{"update_id": 2}`)
+	}()
+
+	select {
+	case rec := <-done:
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler blocked on the full updates")
+	}
+
+	if update := <-updates; update.UpdateID != 1 {
+		t.Errorf("queued update = %d, want 1", update.UpdateID)
+	}
+	if len(updates) != 0 {
+		t.Errorf("delivered %d more updates, want the dropped one to be gone", len(updates))
+	}
+}
+
+func TestListenWebhookClosesUpdates(t *testing.T) {
+	b := TelegramBot{bot: &tgbotapi.BotAPI{Buffer: 1}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, err := b.ListenWebhook(ctx, WebhookOption{ListenAddr: "127.0.0.1:0", Path: "/webhook", SecretToken: testSecretToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-updates:
+		if ok {
+			t.Error("received an update, want the updates closed")
+		}
+	case <-time.After(webhookShutdownTimeout):
+		t.Fatal("updates not closed after the server stopped")
+	}
+}
+
+func serveWebhook(handler http.Handler, method, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/webhook", strings.NewReader(body))
+	if token != "" {
+		req.Header.Set(SecretTokenHeader, token)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	return rec
+}
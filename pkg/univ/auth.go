@@ -2,16 +2,34 @@ package univ
 
 import (
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/driver"
+	"github.com/Kcrong/autostudy/pkg/failure"
 )
 
-func Login(d selenium.WebDriver, url, id, pw string, afterUrl *string) error {
+// Login submits the credentials to the login form of url.
+// If the LMS asks a one-time code after the password, it is asked with otpFunc.
+func Login(d selenium.WebDriver, url, id, pw string, afterUrl *string, otpFunc OTPFuncType) error {
+	// NOTE: Login failures are shown by alerts, which diagnoseLogin reads itself.
+	d = driver.WithoutDialogHandler(d)
+
 	if err := d.Get(url); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("d.Get(%s)", url))
 	}
 
+	// NOTE: The main page can be redirected to the login page of SSO.
+	loginUrl, err := d.CurrentURL()
+	if err != nil {
+		return errors.Wrap(err, "d.CurrentURL()")
+	}
+
 	idElement, err := d.FindElement(selenium.ByID, "username")
 	if err != nil {
 		return errors.Wrap(err, "d.FindElement(selenium.ByID, username)")
@@ -31,16 +49,177 @@ func Login(d selenium.WebDriver, url, id, pw string, afterUrl *string) error {
 		return errors.Wrap(err, "pwElement.SendKeys(selenium.EnterKey)")
 	}
 
+	waitLoginNavigation(d, loginUrl)
+
+	if input := findOTPInput(d); input != nil {
+		if err := submitOTP(d, input, otpFunc); err != nil {
+			return err
+		}
+	}
+
 	if afterUrl != nil {
-		cu, err := d.CurrentURL()
+		return diagnoseLogin(d, *afterUrl)
+	}
+
+	return nil
+}
+
+// Auth logs in to the LMS, and logs in again when the session has expired in the middle of a run.
+type Auth struct {
+	Url        string
+	ProfileUrl string
+	// LoginUrl is the page a request is redirected to when the session has expired.
+	LoginUrl string
+	ID       string
+	PW       string
+	// Cookies saves the session to skip the login. Nil to always log in.
+	Cookies *CookieStore
+	// OTPFunc asks the one-time code if the LMS asks it. Nil to fail the login instead.
+	OTPFunc OTPFuncType
+
+	// NOTE: Sessions log in one by one, so that the code is asked once and the others restore the saved session.
+	mu sync.Mutex
+	// blocked is the login failure stopping every later login, not to lock the account.
+	blocked error
+	// cancelled is the login failure failing the logins waiting for it, and when it failed.
+	cancelled   error
+	cancelledAt time.Time
+}
+
+// Authenticate restores the session saved in Cookies if it is still valid, or logs in again and saves the new session.
+// The session is valid if ProfileUrl is loaded without being redirected to the login page.
+func (a *Auth) Authenticate(d selenium.WebDriver) error {
+	requestedAt := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.blocked != nil {
+		return a.blocked
+	}
+	// NOTE: A session waiting for the login which was cancelled would ask the owner once more, and wait as long.
+	if a.cancelled != nil && a.cancelledAt.After(requestedAt) {
+		return a.cancelled
+	}
+
+	if a.Cookies != nil {
+		ok, err := restoreSession(d, a.Cookies, a.Url, a.ProfileUrl)
 		if err != nil {
-			return errors.Wrap(err, "d.CurrentURL()")
+			// NOTE: The saved session is only a shortcut. Log in again instead.
+			log.Warnf("failed to restore the session: %+v", err)
+		}
+		if ok {
+			return nil
 		}
+	}
+
+	if err := a.login(d); err != nil {
+		return err
+	}
 
-		if cu != *afterUrl {
-			return errors.Errorf("Login failed. Expected url: %s, Actual url: %s", *afterUrl, cu)
+	if a.Cookies != nil {
+		if err := a.Cookies.Save(d); err != nil {
+			log.Warnf("failed to save the session: %+v", err)
 		}
 	}
 
 	return nil
 }
+
+// login logs in, trying again as the LoginRetryPolicy of the failure. It is called with mu held.
+func (a *Auth) login(d selenium.WebDriver) error {
+	for attempt := 1; ; attempt++ {
+		err := Login(d, a.Url, a.ID, a.PW, &a.ProfileUrl, a.OTPFunc)
+
+		var loginErr *LoginError
+		if !errors.As(err, &loginErr) {
+			return err
+		}
+
+		policy := loginErr.RetryPolicy()
+		if attempt >= policy.Attempts {
+			if policy.Block {
+				a.blocked = err
+			}
+			if policy.Cancel {
+				a.cancelled, a.cancelledAt = err, time.Now()
+			}
+			return err
+		}
+
+		log.Warnf("%v, try again in %s", err, policy.Backoff)
+		time.Sleep(policy.Backoff)
+	}
+}
+
+// navigate moves to url. If redirected to the login page, it logs in again and moves to url once more.
+func (a *Auth) navigate(d selenium.WebDriver, url string) error {
+	if err := driver.AssertUrl(url, d); err != nil {
+		return err
+	}
+
+	expired, err := a.isExpired(d)
+	if err != nil || !expired {
+		return err
+	}
+
+	log.Warnf("session expired, log in again to move to %s", url)
+	if err := a.Authenticate(d); err != nil {
+		return err
+	}
+
+	if err := driver.AssertUrl(url, d); err != nil {
+		return err
+	}
+
+	if expired, err := a.isExpired(d); err != nil {
+		return err
+	} else if expired {
+		// NOTE: Returned if a page is still redirected to the login page after logging in again.
+		return errors.Wrap(failure.ErrSessionExpired, url)
+	}
+
+	return nil
+}
+
+// isExpired returns true if the current page is the login page.
+func (a *Auth) isExpired(d selenium.WebDriver) (bool, error) {
+	if a.LoginUrl == "" {
+		return false, nil
+	}
+
+	cu, err := d.CurrentURL()
+	if err != nil {
+		return false, errors.Wrap(err, "d.CurrentURL()")
+	}
+
+	// NOTE: This is a workaround for ignoring query strings, same as AssertUrl.
+	return strings.Contains(cu, a.LoginUrl), nil
+}
+
+func restoreSession(d selenium.WebDriver, store *CookieStore, url, profileUrl string) (bool, error) {
+	cookies, err := store.Load(time.Now())
+	if err != nil || len(cookies) == 0 {
+		return false, err
+	}
+
+	// NOTE: Cookies can only be added to the domain of the current page.
+	if err := d.Get(url); err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("d.Get(%s)", url))
+	}
+	for i := range cookies {
+		if err := d.AddCookie(&cookies[i]); err != nil {
+			return false, errors.Wrap(err, fmt.Sprintf("d.AddCookie(%s)", cookies[i].Name))
+		}
+	}
+
+	if err := d.Get(profileUrl); err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("d.Get(%s)", profileUrl))
+	}
+
+	cu, err := d.CurrentURL()
+	if err != nil {
+		return false, errors.Wrap(err, "d.CurrentURL()")
+	}
+
+	return cu == profileUrl, nil
+}
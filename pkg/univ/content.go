@@ -0,0 +1,342 @@
+package univ
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/driver"
+	"github.com/Kcrong/autostudy/pkg/failure"
+)
+
+const (
+	// documentViewTime is how long a document is kept open after scrolled to the end.
+	documentViewTime = 10 * time.Second
+	// linkViewTime is how long an external link is kept open.
+	linkViewTime = 5 * time.Second
+)
+
+// LectureType is the kind of the content of a lecture.
+type LectureType int
+
+const (
+	LectureTypeVideo LectureType = iota
+	LectureTypeDocument
+	LectureTypeLink
+	LectureTypeSurvey
+	LectureTypeRecording
+	LectureTypeUnknown
+)
+
+func (t LectureType) String() string {
+	switch t {
+	case LectureTypeVideo:
+		return "video"
+	case LectureTypeDocument:
+		return "document"
+	case LectureTypeLink:
+		return "link"
+	case LectureTypeSurvey:
+		return "survey"
+	case LectureTypeRecording:
+		return "recording"
+	default:
+		return "unknown"
+	}
+}
+
+// hasPlaybackStatus reports whether the lecture page shows the playback minutes of the lecture.
+func (t LectureType) hasPlaybackStatus() bool {
+	return t == LectureTypeVideo || t == LectureTypeRecording
+}
+
+// lectureTypeKeywords are matched against the type label and the classes of the lecture, in order.
+// NOTE: Recordings come before videos, since their labels contain the ones of videos.
+var lectureTypeKeywords = []struct {
+	lectureType LectureType
+	keywords    []string
+}{
+	{LectureTypeRecording, []string{"녹화", "recording", "live"}},
+	{LectureTypeDocument, []string{"문서", "pdf", "document"}},
+	{LectureTypeLink, []string{"링크", "link", "url"}},
+	{LectureTypeSurvey, []string{"설문", "survey"}},
+	{LectureTypeVideo, []string{"영상", "video", "vod", "movie"}},
+}
+
+// detectLectureType detects the type of the lecture from its type label, then from the classes of the label and itself.
+// Lectures without a type label are videos, which were the only type the lecture page had.
+func detectLectureType(lectureElement selenium.WebElement) LectureType {
+	class, _ := lectureElement.GetAttribute("class")
+
+	typeElement, err := lectureElement.FindElement(selenium.ByClassName, "lecture-type")
+	if err != nil {
+		if t, ok := matchLectureClass(class); ok {
+			return t
+		}
+		return LectureTypeVideo
+	}
+
+	text, _ := typeElement.Text()
+	if t, ok := matchLectureLabel(text); ok {
+		return t
+	}
+
+	typeClass, _ := typeElement.GetAttribute("class")
+	if t, ok := matchLectureClass(typeClass + " " + class); ok {
+		return t
+	}
+
+	return LectureTypeUnknown
+}
+
+// matchLectureLabel returns the type whose keyword is in the text of the type label, e.g. "동영상".
+func matchLectureLabel(text string) (LectureType, bool) {
+	text = strings.ToLower(text)
+	for _, tk := range lectureTypeKeywords {
+		for _, keyword := range tk.keywords {
+			if strings.Contains(text, keyword) {
+				return tk.lectureType, true
+			}
+		}
+	}
+
+	return LectureTypeUnknown, false
+}
+
+// matchLectureClass returns the type whose keyword is a whole word of the classes, e.g. live of "ico-live",
+// so that it is not matched by a part of a word such as "delivery".
+func matchLectureClass(class string) (LectureType, bool) {
+	words := strings.FieldsFunc(strings.ToLower(class), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, tk := range lectureTypeKeywords {
+		for _, keyword := range tk.keywords {
+			for _, word := range words {
+				if word == keyword {
+					return tk.lectureType, true
+				}
+			}
+		}
+	}
+
+	return LectureTypeUnknown, false
+}
+
+// contentHandlerFuncType completes the content of the lecture in the lecture window.
+type contentHandlerFuncType func(wd selenium.WebDriver, l Lecture, watchdog Watchdog, playbackFunc PlaybackFuncType) error
+
+var contentHandlers = map[LectureType]contentHandlerFuncType{
+	LectureTypeVideo:     watchVideo,
+	LectureTypeRecording: watchVideo,
+	LectureTypeDocument:  viewDocument,
+	LectureTypeLink:      visitLink,
+	LectureTypeSurvey:    answerSurvey,
+}
+
+// lectureWindowMarkerFuncType reports whether the current window shows the content of a lecture of the type.
+// It is checked while the window is loaded, so it returns false for the errors of the driver.
+type lectureWindowMarkerFuncType func(wd selenium.WebDriver, lmsUrl string) bool
+
+var lectureWindowMarkers = map[LectureType]lectureWindowMarkerFuncType{
+	LectureTypeVideo:     hasPlayer,
+	LectureTypeRecording: hasPlayer,
+	LectureTypeDocument:  hasDocumentViewer,
+	LectureTypeLink:      isExternalPage,
+	LectureTypeSurvey:    hasSurveyForm,
+}
+
+// surveySubmitSelector finds the submit button of a survey.
+const surveySubmitSelector = "button[type=submit], input[type=submit], .btn-submit"
+
+// hasPlayer reports whether the player frame of the window has a player.
+func hasPlayer(wd selenium.WebDriver, _ string) bool {
+	iframeElement, err := wd.FindElement(selenium.ByTagName, "iframe")
+	if err != nil {
+		return false
+	}
+	if err := wd.SwitchFrame(iframeElement); err != nil {
+		return false
+	}
+	defer func() {
+		_ = wd.SwitchFrame(nil)
+	}()
+
+	_, err = detectPlayer(wd)
+	return err == nil
+}
+
+func hasDocumentViewer(wd selenium.WebDriver, _ string) bool {
+	elements, err := wd.FindElements(selenium.ByCSSSelector, "iframe, embed, object")
+	return err == nil && len(elements) > 0
+}
+
+// isExternalPage reports whether the window left the LMS, which a link lecture opens.
+func isExternalPage(wd selenium.WebDriver, lmsUrl string) bool {
+	cu, err := wd.CurrentURL()
+	if err != nil {
+		return false
+	}
+
+	current, err := url.Parse(cu)
+	if err != nil || current.Host == "" {
+		return false
+	}
+	lms, err := url.Parse(lmsUrl)
+	if err != nil {
+		return false
+	}
+
+	return current.Host != lms.Host
+}
+
+func hasSurveyForm(wd selenium.WebDriver, _ string) bool {
+	_, err := wd.FindElement(selenium.ByCSSSelector, surveySubmitSelector)
+	return err == nil
+}
+
+// ContentOption decides which content is completed on behalf of the user.
+type ContentOption struct {
+	// AnswerSurveys submits surveys with the first choice of each question. Surveys are unsupported otherwise,
+	// since the answers are put on record as the ones of the user.
+	AnswerSurveys bool
+}
+
+// Supports reports whether the content of the lecture can be completed.
+func (o ContentOption) Supports(l Lecture) bool {
+	_, ok := o.handler(l)
+	return ok
+}
+
+func (o ContentOption) handler(l Lecture) (contentHandlerFuncType, bool) {
+	if l.Type == LectureTypeSurvey && !o.AnswerSurveys {
+		return nil, false
+	}
+
+	handler, ok := contentHandlers[l.Type]
+	return handler, ok
+}
+
+func unsupportedError(l Lecture) error {
+	return failure.Wrap(errors.Errorf("%s: %s", l.Title, l.Type), failure.ErrUnsupportedContent)
+}
+
+func watchVideo(wd selenium.WebDriver, l Lecture, watchdog Watchdog, playbackFunc PlaybackFuncType) error {
+	if !l.HasPlayed {
+		if err := play(wd, l, watchdog, playbackFunc); err != nil {
+			return err
+		}
+	}
+	if l.HasExam {
+		if err := solveQuiz(wd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// viewDocument scrolls the document viewer to the end, in the page and in each frame, and keeps it open for a while.
+func viewDocument(wd selenium.WebDriver, l Lecture, _ Watchdog, _ PlaybackFuncType) error {
+	if err := waitPageLoaded(wd); err != nil {
+		return err
+	}
+
+	if err := scrollToEnd(wd); err != nil {
+		return err
+	}
+
+	iframeElements, err := wd.FindElements(selenium.ByTagName, "iframe")
+	if err != nil {
+		return errors.Wrap(err, "wd.FindElements(selenium.ByTagName, \"iframe\")")
+	}
+	for _, iframeElement := range iframeElements {
+		if err := wd.SwitchFrame(iframeElement); err != nil {
+			return errors.Wrap(err, "wd.SwitchFrame(iframeElement)")
+		}
+		err := scrollToEnd(wd)
+		if switchErr := wd.SwitchFrame(nil); switchErr != nil {
+			return errors.Wrap(switchErr, "wd.SwitchFrame(nil)")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	time.Sleep(documentViewTime)
+
+	if l.HasExam {
+		return solveQuiz(wd)
+	}
+
+	return nil
+}
+
+// visitLink keeps the external link open for a while. The LMS counts it as done when it is opened.
+func visitLink(wd selenium.WebDriver, _ Lecture, _ Watchdog, _ PlaybackFuncType) error {
+	if err := waitPageLoaded(wd); err != nil {
+		return err
+	}
+
+	time.Sleep(linkViewTime)
+
+	return nil
+}
+
+// answerSurvey picks the first choice of each question, then submits the survey.
+// It is only used if ContentOption.AnswerSurveys is set.
+func answerSurvey(wd selenium.WebDriver, _ Lecture, _ Watchdog, _ PlaybackFuncType) error {
+	if err := waitPageLoaded(wd); err != nil {
+		return err
+	}
+
+	if _, err := wd.ExecuteScript(`
+		var picked = {};
+		document.querySelectorAll("input[type=radio]").forEach(function (input) {
+			if (!picked[input.name]) {
+				picked[input.name] = true;
+				input.click();
+			}
+		});
+	`, nil); err != nil {
+		return errors.Wrap(err, "wd.ExecuteScript(pick survey choices)")
+	}
+
+	submitElement, err := wd.FindElement(selenium.ByCSSSelector, surveySubmitSelector)
+	if err != nil {
+		return errors.Wrap(err, "wd.FindElement(survey submit)")
+	}
+	if err := submitElement.Click(); err != nil {
+		return errors.Wrap(err, "submitElement.Click()")
+	}
+
+	return driver.HandleDialog(wd)
+}
+
+func waitPageLoaded(wd selenium.WebDriver) error {
+	if err := wd.Wait(func(wd selenium.WebDriver) (bool, error) {
+		state, err := wd.ExecuteScript(`return document.readyState;`, nil)
+		return err == nil && state == "complete", nil
+	}); err != nil {
+		return errors.Wrap(err, "wait for the page to be loaded")
+	}
+
+	return nil
+}
+
+// scrollToEnd scrolls the page and every scrollable element in it to the end.
+func scrollToEnd(wd selenium.WebDriver) error {
+	_, err := wd.ExecuteScript(`
+		window.scrollTo(0, document.body ? document.body.scrollHeight : 0);
+		document.querySelectorAll("*").forEach(function (e) {
+			if (e.scrollHeight > e.clientHeight) {
+				e.scrollTop = e.scrollHeight;
+			}
+		});
+	`, nil)
+	return errors.Wrap(err, "wd.ExecuteScript(scroll to end)")
+}
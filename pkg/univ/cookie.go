@@ -0,0 +1,145 @@
+package univ
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+)
+
+// CookieStore saves the cookies of a logged in session to a file encrypted with AES-GCM,
+// so that new sessions can skip the login.
+type CookieStore struct {
+	path string
+	aead cipher.AEAD
+	mu   sync.Mutex
+	// memory is the cookies of the store without a file.
+	memory []selenium.Cookie
+}
+
+// NewMemoryCookieStore returns a store keeping the cookies in memory only,
+// so that the sessions of a process share the login without saving it.
+func NewMemoryCookieStore() *CookieStore {
+	return &CookieStore{}
+}
+
+// NewCookieStore returns a store encrypting the cookies with the key derived from secret.
+func NewCookieStore(path, secret string) (*CookieStore, error) {
+	if secret == "" {
+		return nil, errors.New("secret is required to encrypt cookies")
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "aes.NewCipher")
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "cipher.NewGCM")
+	}
+
+	return &CookieStore{
+		path: path,
+		aead: aead,
+	}, nil
+}
+
+// Save saves the cookies of the current page.
+func (s *CookieStore) Save(wd selenium.WebDriver) error {
+	cookies, err := wd.GetCookies()
+	if err != nil {
+		return errors.Wrap(err, "wd.GetCookies")
+	}
+
+	if s.aead == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.memory = cookies
+		return nil
+	}
+
+	plain, err := json.Marshal(cookies)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, "rand.Read")
+	}
+	sealed := s.aead.Seal(nonce, nonce, plain, nil)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, sealed, 0600); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("ioutil.WriteFile(%s)", tmp))
+	}
+
+	return errors.Wrap(os.Rename(tmp, s.path), "os.Rename")
+}
+
+// Load returns the saved cookies not expired yet. It returns nothing if no cookies are saved.
+func (s *CookieStore) Load(now time.Time) ([]selenium.Cookie, error) {
+	if s.aead == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return unexpired(s.memory, now), nil
+	}
+
+	s.mu.Lock()
+	sealed, err := ioutil.ReadFile(s.path)
+	s.mu.Unlock()
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("ioutil.ReadFile(%s)", s.path))
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.Errorf("broken cookie file: %s", s.path)
+	}
+
+	plain, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		// NOTE: The secret may have been changed since the cookies were saved.
+		return nil, errors.Wrap(err, "aead.Open")
+	}
+
+	var cookies []selenium.Cookie
+	if err := json.Unmarshal(plain, &cookies); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	return unexpired(cookies, now), nil
+}
+
+func unexpired(cookies []selenium.Cookie, now time.Time) []selenium.Cookie {
+	var valid []selenium.Cookie
+	for _, cookie := range cookies {
+		// NOTE: Session cookies have no expiry.
+		if cookie.Expiry == 0 || int64(cookie.Expiry) > now.Unix() {
+			valid = append(valid, cookie)
+		}
+	}
+
+	return valid
+}
@@ -0,0 +1,239 @@
+package univ
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/driver"
+	"github.com/Kcrong/autostudy/pkg/failure"
+	"github.com/Kcrong/autostudy/pkg/noti"
+)
+
+const (
+	verifyAttempts = 3
+	verifyInterval = 10 * time.Second
+
+	// lectureWindowTimeout is how long the lecture window can take to be opened and show its content after clicked.
+	lectureWindowTimeout = time.Minute
+)
+
+// Executor watches the lectures of a Plan.
+type Executor struct {
+	wd       selenium.WebDriver
+	url      string
+	auth     *Auth
+	progress *noti.Progress
+	content  ContentOption
+	watchdog Watchdog
+}
+
+func NewExecutor(wd selenium.WebDriver, url string, auth *Auth, progress *noti.Progress, content ContentOption, watchdog Watchdog) *Executor {
+	return &Executor{
+		wd:       wd,
+		url:      url,
+		auth:     auth,
+		progress: progress,
+		content:  content,
+		watchdog: watchdog,
+	}
+}
+
+// Watch locates the lecture in the lecture page again, then watches it.
+// The lecture is completed only when the lecture page shows it is done.
+func (e *Executor) Watch(l Lecture) error {
+	key := l.ID.String()
+	if err := e.progress.StartLecture(key, l.Title); err != nil {
+		return err
+	}
+
+	err := e.watch(l, key)
+	if errors.Is(err, failure.ErrSessionExpired) {
+		// NOTE: A long playback can outlive the session. Log in again, then retry the lecture once.
+		log.Warnf("session expired while watching %s, log in again: %+v", l.Title, err)
+		if err = e.auth.Authenticate(e.wd); err == nil {
+			err = e.watch(l, key)
+		}
+	}
+	if err != nil {
+		// NOTE: The error of the lecture is more important than the one of the progress.
+		// The caller counts the failure, since it may try the lecture again.
+		_ = e.progress.StopLecture(key)
+		return err
+	}
+
+	if err := e.verify(l); err != nil {
+		_ = e.progress.StopLecture(key)
+		return err
+	}
+
+	return e.progress.CompleteLecture(key)
+}
+
+// verify reads the status of the lecture from the lecture page again, and returns failure.ErrNotCredited if it is not done.
+// The page is reloaded a few times, since the LMS can take a while to record the completion.
+func (e *Executor) verify(l Lecture) error {
+	var status Lecture
+	for attempt := 1; attempt <= verifyAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(verifyInterval)
+		}
+
+		if err := e.wd.Refresh(); err != nil {
+			return errors.Wrap(err, "wd.Refresh()")
+		}
+
+		lectureElement, err := driver.Resolve(e.wd, driver.Locator{
+			Name: "lecture " + l.ID.String(),
+			Find: func(selenium.WebDriver) (selenium.WebElement, error) {
+				return e.locateLecture(l)
+			},
+		})
+		if err != nil {
+			return layoutError(err)
+		}
+
+		status, err = ParseLecture(l.SubjectTitle, lectureElement)
+		if err != nil {
+			return layoutError(err)
+		}
+		if status.IsDone() {
+			return nil
+		}
+	}
+
+	return failure.Wrap(errors.Errorf(
+		"played but not credited: %s, playback: %s / %s, quiz done: %t",
+		l.Title, status.PlaybackLocation, status.PlaybackDuration, !status.ShouldBeExamined(),
+	), failure.ErrNotCredited)
+}
+
+// watch opens and watches the lecture. If the watchdog could not recover the playback, the lecture is opened once again.
+func (e *Executor) watch(l Lecture, key string) error {
+	if !e.content.Supports(l) {
+		return unsupportedError(l)
+	}
+
+	err := e.open(l, key)
+
+	var stalled *stalledError
+	if errors.As(err, &stalled) {
+		e.watchdog.report(l, RecoveryReopen, stalled.location)
+		err = e.open(l, key)
+	}
+	if errors.As(err, &stalled) {
+		return failure.Wrap(errors.Wrap(err, "reopened the lecture"), failure.ErrPlayerTimeout)
+	}
+
+	return err
+}
+
+// open clicks the lecture, and watches it in the lecture window opened.
+// The main window is restored even if the lecture fails, not to leave the lecture window to the next lecture.
+func (e *Executor) open(l Lecture, key string) (err error) {
+	windows, err := driver.TrackWindows(e.wd)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if restoreErr := windows.Restore(); err == nil {
+			err = restoreErr
+		} else if restoreErr != nil {
+			log.Warnf("failed to restore the main window: %+v", restoreErr)
+		}
+	}()
+
+	// NOTE: The lecture is located again when clicked, since the page can be reloaded by AssertUrl.
+	if err := driver.Click(e.wd, driver.Locator{
+		Name: "lecture " + l.ID.String(),
+		Find: func(selenium.WebDriver) (selenium.WebElement, error) {
+			return e.locate(l)
+		},
+	}); err != nil {
+		return layoutError(err)
+	}
+
+	if _, err := windows.WaitNew(lectureWindowTimeout, func(wd selenium.WebDriver) (bool, error) {
+		return isLectureWindow(wd, l, e.url), nil
+	}); err != nil {
+		return errors.Wrap(err, "lecture window of "+l.Title)
+	}
+
+	return watchLecture(e.wd, e.auth, l, e.content, e.watchdog, func(current, total time.Duration) {
+		// NOTE: Progress is informative only. Do not stop playback for it.
+		_ = e.progress.UpdatePlayback(key, current, total)
+	})
+}
+
+// locate returns the title element of the lecture, which opens the lecture window when clicked.
+func (e *Executor) locate(l Lecture) (selenium.WebElement, error) {
+	lectureElement, err := e.locateLecture(l)
+	if err != nil {
+		return nil, err
+	}
+
+	return findLectureTitleElement(lectureElement)
+}
+
+// locateLecture returns the element of the lecture in the lecture page.
+// The lecture is looked up by its position first, then by its title if the page has changed since the scan.
+func (e *Executor) locateLecture(l Lecture) (selenium.WebElement, error) {
+	subjectElements, err := findSubjectElements(e.url, e.wd, e.auth)
+	if err != nil {
+		return nil, err
+	}
+
+	subjectElement, err := pickElement(subjectElements, l.position.subject, l.SubjectTitle, extractSubjectTitle)
+	if err != nil {
+		return nil, errors.Wrapf(err, "subject %s", l.SubjectTitle)
+	}
+
+	lectureElements, err := expandLectureElements(e.wd, subjectElement)
+	if err != nil {
+		return nil, err
+	}
+
+	lectureElement, err := pickElement(lectureElements, l.position.lecture, l.Title, extractLectureTitle)
+	if err != nil {
+		return nil, errors.Wrapf(err, "lecture %s", l.Title)
+	}
+
+	return lectureElement, nil
+}
+
+// isLectureWindow reports whether the current window shows the content of the lecture, by its marker of the type.
+func isLectureWindow(wd selenium.WebDriver, l Lecture, lmsUrl string) bool {
+	marker, ok := lectureWindowMarkers[l.Type]
+	if !ok {
+		return false
+	}
+
+	return marker(wd, lmsUrl)
+}
+
+func pickElement(elements []selenium.WebElement, idx int, title string, titleFunc func(selenium.WebElement) (string, error)) (selenium.WebElement, error) {
+	if idx >= 0 && idx < len(elements) {
+		t, err := titleFunc(elements[idx])
+		if driver.IsStaleElementError(err) {
+			return nil, err
+		}
+		if err == nil && t == title {
+			return elements[idx], nil
+		}
+	}
+
+	for _, element := range elements {
+		t, err := titleFunc(element)
+		if driver.IsStaleElementError(err) {
+			// NOTE: Let the caller retry with the elements found again.
+			return nil, err
+		}
+		if err == nil && t == title {
+			return element, nil
+		}
+	}
+
+	return nil, errors.Errorf("not found in the page: %s", title)
+}
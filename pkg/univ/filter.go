@@ -0,0 +1,94 @@
+package univ
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+type RuleAction string
+
+const (
+	RuleInclude RuleAction = "include"
+	RuleExclude RuleAction = "exclude"
+)
+
+type RuleTarget string
+
+const (
+	RuleTargetSubject RuleTarget = "subject"
+	RuleTargetLecture RuleTarget = "lecture"
+)
+
+// Rule includes or excludes lectures by the title of the lecture or of its subject.
+type Rule struct {
+	Action  RuleAction
+	Target  RuleTarget
+	Pattern *regexp.Regexp
+}
+
+func NewRule(action, target, pattern string) (Rule, error) {
+	a := RuleAction(action)
+	if a != RuleInclude && a != RuleExclude {
+		return Rule{}, errors.Errorf("invalid rule action: %s", action)
+	}
+
+	t := RuleTarget(target)
+	if t != RuleTargetSubject && t != RuleTargetLecture {
+		return Rule{}, errors.Errorf("invalid rule target: %s", target)
+	}
+
+	p, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, errors.Wrapf(err, "regexp.Compile(%s)", pattern)
+	}
+
+	return Rule{
+		Action:  a,
+		Target:  t,
+		Pattern: p,
+	}, nil
+}
+
+func (r Rule) String() string {
+	return string(r.Action) + " " + string(r.Target) + " " + r.Pattern.String()
+}
+
+func (r Rule) match(l Lecture) bool {
+	if r.Target == RuleTargetSubject {
+		return r.Pattern.MatchString(l.SubjectTitle)
+	}
+
+	return r.Pattern.MatchString(l.Title)
+}
+
+type Rules []Rule
+
+// Allow reports whether the lecture passes the rules.
+// A lecture is allowed if it matches no exclude rule, and at least one include rule of each target having include rules.
+func (rs Rules) Allow(l Lecture) bool {
+	hasInclude := map[RuleTarget]bool{}
+	included := map[RuleTarget]bool{}
+
+	for _, r := range rs {
+		switch r.Action {
+		case RuleExclude:
+			if r.match(l) {
+				return false
+			}
+		case RuleInclude:
+			hasInclude[r.Target] = true
+			if r.match(l) {
+				included[r.Target] = true
+			}
+		}
+	}
+
+	for target := range hasInclude {
+		if !included[target] {
+			return false
+		}
+	}
+
+	return true
+}
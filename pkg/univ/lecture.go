@@ -11,8 +11,28 @@ import (
 	"github.com/Kcrong/autostudy/pkg/driver"
 )
 
+// LectureID identifies a lecture by the titles of its subject and itself, which are kept between scans unlike its position.
+type LectureID struct {
+	Subject string
+	Lecture string
+}
+
+func (id LectureID) String() string {
+	return id.Subject + " - " + id.Lecture
+}
+
+// lecturePosition is the position of a lecture in the lecture page when scanned.
+// It is tried first to locate the lecture again, before looking it up by its title.
+type lecturePosition struct {
+	subject int
+	lecture int
+}
+
 type Lecture struct {
-	Title string
+	ID           LectureID
+	Title        string
+	SubjectTitle string
+	Type         LectureType
 
 	IsReadied bool
 
@@ -23,7 +43,10 @@ type Lecture struct {
 	PlaybackLocation time.Duration
 	PlaybackDuration time.Duration
 
-	ButtonElement selenium.WebElement
+	// Deadline is zero if the lecture page does not show it.
+	Deadline time.Time
+
+	position lecturePosition
 }
 
 func (l Lecture) ShouldBePlayed() bool {
@@ -47,52 +70,99 @@ func (l Lecture) IsDone() bool {
 	return !l.ShouldBePlayed() && !l.ShouldBeExamined()
 }
 
-func ParseLecture(lectureElement selenium.WebElement, watchFunc WatchFuncType) (*Lecture, error) {
-	titleElement, err := lectureElement.FindElement(selenium.ByClassName, "lecture-title")
-	if err != nil {
-		return nil, errors.Wrap(err, "lectureElement.FindElement(lecture-title)")
+// RemainingPlayback is the playback duration not watched yet.
+func (l Lecture) RemainingPlayback() time.Duration {
+	if l.HasPlayed || l.PlaybackLocation >= l.PlaybackDuration {
+		return 0
 	}
 
-	title, err := titleElement.Text()
+	return l.PlaybackDuration - l.PlaybackLocation
+}
+
+func ParseLecture(subjectTitle string, lectureElement selenium.WebElement) (Lecture, error) {
+	title, err := extractLectureTitle(lectureElement)
 	if err != nil {
-		return nil, errors.Wrap(err, "titleElement.Text")
+		return Lecture{}, err
 	}
+	id := LectureID{Subject: subjectTitle, Lecture: title}
+
+	lectureType := detectLectureType(lectureElement)
 
 	if !isLectureReady(lectureElement) {
-		return &Lecture{
-			Title:     title,
-			IsReadied: false,
+		return Lecture{
+			ID:           id,
+			Title:        title,
+			SubjectTitle: subjectTitle,
+			Type:         lectureType,
+			IsReadied:    false,
 		}, nil
 	}
 
 	lectureStatusElement, err := lectureElement.FindElement(selenium.ByClassName, "lecture-list-in")
 	if err != nil {
-		return nil, errors.Wrap(err, "lectureElement.FindElement(lecture-list-in)")
+		return Lecture{}, errors.Wrap(err, "lectureElement.FindElement(lecture-list-in)")
+	}
+
+	if !lectureType.hasPlaybackStatus() {
+		hasCompleted, hasExam, hasExamCompleted, err := extractCompletion(lectureStatusElement)
+		if err != nil {
+			return Lecture{}, err
+		}
+
+		return Lecture{
+			ID:               id,
+			Title:            title,
+			SubjectTitle:     subjectTitle,
+			Type:             lectureType,
+			IsReadied:        true,
+			HasPlayed:        hasCompleted,
+			HasExam:          hasExam,
+			HasExamCompleted: hasExamCompleted,
+			Deadline:         extractDeadline(lectureElement),
+		}, nil
 	}
 
 	hasPlayed, hasExam, hasExamCompleted, playbackLocationMin, playbackDurationMin, err := extractLectureStatus(lectureStatusElement)
 	if err != nil {
-		return nil, err
+		return Lecture{}, err
 	}
 
-	lecture := &Lecture{
+	return Lecture{
+		ID:               id,
 		Title:            title,
+		SubjectTitle:     subjectTitle,
+		Type:             lectureType,
 		IsReadied:        true,
 		HasPlayed:        hasPlayed,
 		HasExam:          hasExam,
 		HasExamCompleted: hasExamCompleted,
 		PlaybackLocation: playbackLocationMin,
 		PlaybackDuration: playbackDurationMin,
-		ButtonElement:    titleElement,
+		Deadline:         extractDeadline(lectureElement),
+	}, nil
+}
+
+func findLectureTitleElement(lectureElement selenium.WebElement) (selenium.WebElement, error) {
+	titleElement, err := lectureElement.FindElement(selenium.ByClassName, "lecture-title")
+	if err != nil {
+		return nil, errors.Wrap(err, "lectureElement.FindElement(lecture-title)")
 	}
 
-	if watchFunc != nil && !lecture.IsDone() {
-		if err := watchFunc(lecture); err != nil {
-			return nil, err
-		}
+	return titleElement, nil
+}
+
+func extractLectureTitle(lectureElement selenium.WebElement) (string, error) {
+	titleElement, err := findLectureTitleElement(lectureElement)
+	if err != nil {
+		return "", err
+	}
+
+	title, err := titleElement.Text()
+	if err != nil {
+		return "", errors.Wrap(err, "titleElement.Text")
 	}
 
-	return lecture, nil
+	return title, nil
 }
 
 func isLectureReady(lectureElement selenium.WebElement) bool {
@@ -130,6 +200,65 @@ func extractLectureStatus(lectureStatusElement selenium.WebElement) (bool, bool,
 	return hasPlayed, hasExam, hasExamCompleted, locationMin, durationMin, nil
 }
 
+// extractCompletion returns whether the lecture without playback is completed, and its exam status,
+// from the first and the second status of the lecture. Both are optional.
+func extractCompletion(lectureStatusElement selenium.WebElement) (bool, bool, bool, error) {
+	liElements, err := lectureStatusElement.FindElements(selenium.ByTagName, "li")
+	if err != nil {
+		return false, false, false, errors.Wrap(err, "lectureStatusElement.FindElements")
+	}
+
+	if len(liElements) == 0 {
+		return false, false, false, nil
+	}
+
+	var hasCompleted bool
+	a, err := liElements[0].FindElement(selenium.ByTagName, "a")
+	if err == nil {
+		if hasCompleted, err = isChecked(a); err != nil {
+			return false, false, false, err
+		}
+	} else if !driver.IsNoSuchElementError(err) {
+		return false, false, false, errors.Wrap(err, "liElements[0].FindElement")
+	}
+
+	if len(liElements) < 2 {
+		return hasCompleted, false, false, nil
+	}
+
+	hasExam, hasExamCompleted, err := extractExamInfo(liElements[1])
+	if err != nil {
+		return hasCompleted, false, false, err
+	}
+
+	return hasCompleted, hasExam, hasExamCompleted, nil
+}
+
+// extractDeadline returns the end of the lecture period, or zero time if it is not available.
+func extractDeadline(lectureElement selenium.WebElement) time.Time {
+	periodElement, err := lectureElement.FindElement(selenium.ByClassName, "lecture-period")
+	if err != nil {
+		return time.Time{}
+	}
+
+	text, err := periodElement.Text()
+	if err != nil {
+		return time.Time{}
+	}
+
+	// e.g. "2022.09.01 00:00 ~ 2022.09.14 23:59"
+	periods := strings.Split(text, "~")
+	end := strings.TrimSpace(periods[len(periods)-1])
+
+	for _, layout := range []string{"2006.01.02 15:04", "2006.01.02", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.Parse(layout, end); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
 func extractHasPlayed(playbackElement selenium.WebElement) (bool, error) {
 	a, err := playbackElement.FindElement(selenium.ByTagName, "a")
 	if err != nil {
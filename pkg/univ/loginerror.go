@@ -0,0 +1,198 @@
+package univ
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/failure"
+)
+
+const loginNavigationTimeout = 15 * time.Second
+
+// LoginFailureReason is why the LMS refused the login.
+type LoginFailureReason string
+
+const (
+	LoginWrongCredentials   LoginFailureReason = "wrong credentials"
+	LoginAccountLocked      LoginFailureReason = "account locked"
+	LoginPasswordChange     LoginFailureReason = "password change required"
+	LoginMaintenance        LoginFailureReason = "maintenance"
+	LoginUnexpectedRedirect LoginFailureReason = "unexpected redirect"
+	LoginOTPRequired        LoginFailureReason = "one-time code required"
+	LoginOTPUnanswered      LoginFailureReason = "one-time code not answered"
+	LoginWrongOTP           LoginFailureReason = "wrong one-time code"
+)
+
+// LoginRetryPolicy is how many times, and how long after, a login failed by a reason is tried again.
+type LoginRetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+	// Block stops every later login until restarted.
+	Block bool
+	// Cancel fails the logins waiting for the failed one with its error, instead of asking the owner again.
+	Cancel bool
+}
+
+// NOTE: Do not retry the failures caused by the account. Repeating a wrong password locks the account.
+var loginRetryPolicies = map[LoginFailureReason]LoginRetryPolicy{
+	LoginWrongCredentials:   {Attempts: 1, Block: true},
+	LoginAccountLocked:      {Attempts: 1, Block: true},
+	LoginPasswordChange:     {Attempts: 1, Block: true},
+	LoginMaintenance:        {Attempts: 3, Backoff: 10 * time.Minute},
+	LoginUnexpectedRedirect: {Attempts: 2, Backoff: 30 * time.Second},
+	LoginOTPRequired:        {Attempts: 1},
+	LoginOTPUnanswered:      {Attempts: 1, Cancel: true},
+	LoginWrongOTP:           {Attempts: 2},
+}
+
+var loginNotifications = map[LoginFailureReason]string{
+	LoginWrongCredentials:   "로그인 실패: 아이디 또는 비밀번호가 틀렸습니다. UNIV_ID, UNIV_PW를 확인해주세요.",
+	LoginAccountLocked:      "로그인 실패: 계정이 잠겼습니다. 학교 사이트에서 잠금을 해제해주세요.",
+	LoginPasswordChange:     "로그인 실패: 비밀번호 변경이 필요합니다. 학교 사이트에서 비밀번호를 변경하고 UNIV_PW를 수정해주세요.",
+	LoginMaintenance:        "로그인 실패: 학교 사이트가 점검 중입니다.",
+	LoginUnexpectedRedirect: "로그인 실패: 예상하지 못한 페이지로 이동했습니다.",
+	LoginOTPRequired:        "로그인 실패: 인증 코드 입력이 필요합니다.",
+	LoginOTPUnanswered:      "로그인 실패: 인증 코드를 받지 못해 실행을 취소했습니다.",
+	LoginWrongOTP:           "로그인 실패: 인증 코드가 틀렸습니다.",
+}
+
+// loginKeywords classifies the message shown by the LMS. The reasons are checked in the order.
+var loginKeywords = []struct {
+	reason   LoginFailureReason
+	keywords []string
+}{
+	{LoginMaintenance, []string{"점검", "maintenance"}},
+	{LoginAccountLocked, []string{"잠금", "잠겼", "locked"}},
+	{LoginPasswordChange, []string{"비밀번호 변경", "비밀번호를 변경", "change your password", "password has expired"}},
+	// NOTE: Wrong credentials block every later login, so only the phrases naming the credentials are matched.
+	{LoginWrongCredentials, []string{
+		"아이디 또는 비밀번호", "비밀번호가 일치하지", "비밀번호가 틀", "비밀번호를 잘못",
+		"incorrect password", "invalid username or password", "invalid id or password",
+	}},
+}
+
+// loginMessageSelectors find the message shown inline by the login page.
+var loginMessageSelectors = []string{".error", ".alert", ".msg", "#errorMsg", ".login-error"}
+
+// LoginError is the diagnosed failure of Login.
+type LoginError struct {
+	Reason LoginFailureReason
+	// Message is the message shown by the LMS, if any.
+	Message string
+	Url     string
+}
+
+func (e *LoginError) Error() string {
+	msg := fmt.Sprintf("login failed: %s at %s", e.Reason, e.Url)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+
+	return msg
+}
+
+// Kind classifies every login failure as failure.ErrLoginFailed.
+func (e *LoginError) Kind() *failure.Kind {
+	return failure.ErrLoginFailed
+}
+
+func (e *LoginError) Is(target error) bool {
+	return target == failure.ErrLoginFailed
+}
+
+// Notification returns the text to notify the owner with.
+func (e *LoginError) Notification() string {
+	text := loginNotifications[e.Reason]
+	if e.Message != "" {
+		text += "\n" + e.Message
+	}
+
+	return text
+}
+
+// RetryPolicy returns how the login should be tried again.
+func (e *LoginError) RetryPolicy() LoginRetryPolicy {
+	return loginRetryPolicies[e.Reason]
+}
+
+// waitLoginNavigation waits for the page to leave loginUrl and be loaded, or for an alert to be shown.
+// Some failures are shown in the login page without navigation, so it is not an error to time out.
+func waitLoginNavigation(d selenium.WebDriver, loginUrl string) {
+	_ = d.WaitWithTimeout(func(d selenium.WebDriver) (bool, error) {
+		if _, err := d.AlertText(); err == nil {
+			return true, nil
+		}
+
+		cu, err := d.CurrentURL()
+		if err != nil || cu == loginUrl {
+			return false, nil
+		}
+
+		state, err := d.ExecuteScript("return document.readyState;", nil)
+		return err == nil && state == "complete", nil
+	}, loginNavigationTimeout)
+}
+
+// diagnoseLogin returns nil if the page is afterUrl, or the LoginError describing the page otherwise.
+func diagnoseLogin(d selenium.WebDriver, afterUrl string) error {
+	// NOTE: Many pages show the failure by an alert, which blocks every other command.
+	if text, err := d.AlertText(); err == nil {
+		if err := d.AcceptAlert(); err != nil {
+			return errors.Wrap(err, "d.AcceptAlert()")
+		}
+
+		cu, _ := d.CurrentURL()
+		return &LoginError{Reason: classifyLoginMessage(text, LoginUnexpectedRedirect), Message: text, Url: cu}
+	}
+
+	cu, err := d.CurrentURL()
+	if err != nil {
+		return errors.Wrap(err, "d.CurrentURL()")
+	}
+	if cu == afterUrl {
+		return nil
+	}
+
+	// NOTE: Only the message of the LMS is classified. The body has too many common words to tell the reason.
+	message := findLoginMessage(d)
+
+	return &LoginError{Reason: classifyLoginMessage(message, LoginUnexpectedRedirect), Message: message, Url: cu}
+}
+
+// classifyLoginMessage returns the reason whose keyword is in text, or fallback if none is.
+// NOTE: Wrong credentials block every later login, so they are never the fallback.
+func classifyLoginMessage(text string, fallback LoginFailureReason) LoginFailureReason {
+	text = strings.ToLower(text)
+	for _, k := range loginKeywords {
+		for _, keyword := range k.keywords {
+			if strings.Contains(text, keyword) {
+				return k.reason
+			}
+		}
+	}
+
+	return fallback
+}
+
+func findLoginMessage(d selenium.WebDriver) string {
+	for _, selector := range loginMessageSelectors {
+		element, err := d.FindElement(selenium.ByCSSSelector, selector)
+		if err != nil {
+			continue
+		}
+
+		if displayed, err := element.IsDisplayed(); err != nil || !displayed {
+			continue
+		}
+
+		if text, err := element.Text(); err == nil && strings.TrimSpace(text) != "" {
+			return strings.TrimSpace(text)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,67 @@
+package univ
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+type OrderPolicy string
+
+const (
+	// OrderDOM keeps the order of the lecture page.
+	OrderDOM OrderPolicy = "dom"
+	// OrderDeadline processes the lecture with the nearest deadline first.
+	OrderDeadline OrderPolicy = "deadline"
+	// OrderShortest processes the lecture with the shortest remaining playback first.
+	OrderShortest OrderPolicy = "shortest"
+	// OrderPriority processes the subjects in the order of the priority patterns.
+	OrderPriority OrderPolicy = "priority"
+)
+
+var orderPolicies = []OrderPolicy{OrderDOM, OrderDeadline, OrderShortest, OrderPriority}
+
+func ParseOrderPolicy(s string) (OrderPolicy, error) {
+	for _, p := range orderPolicies {
+		if OrderPolicy(s) == p {
+			return p, nil
+		}
+	}
+
+	return "", errors.Errorf("invalid order policy: %s, should be one of %v", s, orderPolicies)
+}
+
+// SortLectures sorts the lectures by the policy, keeping the page order for ties.
+// priority is used by OrderPriority. The subjects matching none of them come last.
+func SortLectures(lectures []Lecture, policy OrderPolicy, priority []*regexp.Regexp) {
+	switch policy {
+	case OrderDeadline:
+		sort.SliceStable(lectures, func(i, j int) bool {
+			di, dj := lectures[i].Deadline, lectures[j].Deadline
+			// NOTE: Lectures without deadline come last.
+			if di.IsZero() || dj.IsZero() {
+				return !di.IsZero() && dj.IsZero()
+			}
+
+			return di.Before(dj)
+		})
+	case OrderShortest:
+		sort.SliceStable(lectures, func(i, j int) bool {
+			return lectures[i].RemainingPlayback() < lectures[j].RemainingPlayback()
+		})
+	case OrderPriority:
+		rank := func(l Lecture) int {
+			for i, p := range priority {
+				if p.MatchString(l.SubjectTitle) {
+					return i
+				}
+			}
+
+			return len(priority)
+		}
+		sort.SliceStable(lectures, func(i, j int) bool {
+			return rank(lectures[i]) < rank(lectures[j])
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package univ
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+)
+
+// OTPFuncType asks the one-time code for the second factor of the login, showing prompt.
+type OTPFuncType func(prompt string) (string, error)
+
+// otpInputSelectors find the input of the one-time code shown after the password is submitted.
+var otpInputSelectors = []string{
+	"input[autocomplete='one-time-code']",
+	"input[name*='otp' i]",
+	"input[id*='otp' i]",
+	"#authCode",
+	"#certNum",
+}
+
+// findOTPInput returns the input of the one-time code, or nil if the page does not ask it.
+func findOTPInput(d selenium.WebDriver) selenium.WebElement {
+	for _, selector := range otpInputSelectors {
+		element, err := d.FindElement(selenium.ByCSSSelector, selector)
+		if err != nil {
+			continue
+		}
+
+		if displayed, err := element.IsDisplayed(); err == nil && displayed {
+			return element
+		}
+	}
+
+	return nil
+}
+
+// submitOTP asks the code with otpFunc and submits it to the input.
+func submitOTP(d selenium.WebDriver, input selenium.WebElement, otpFunc OTPFuncType) error {
+	cu, _ := d.CurrentURL()
+	if otpFunc == nil {
+		return &LoginError{Reason: LoginOTPRequired, Url: cu}
+	}
+
+	prompt := findLoginMessage(d)
+	if placeholder, err := input.GetAttribute("placeholder"); err == nil && placeholder != "" {
+		prompt = strings.TrimSpace(prompt + "\n" + placeholder)
+	}
+
+	code, err := otpFunc(prompt)
+	if err != nil {
+		return &LoginError{Reason: LoginOTPUnanswered, Message: err.Error(), Url: cu}
+	}
+
+	if err := input.SendKeys(strings.TrimSpace(code)); err != nil {
+		return errors.Wrap(err, "input.SendKeys(code)")
+	}
+	if err := input.SendKeys(selenium.EnterKey); err != nil {
+		return errors.Wrap(err, "input.SendKeys(selenium.EnterKey)")
+	}
+
+	waitLoginNavigation(d, cu)
+
+	// NOTE: The input is shown again if the code was wrong.
+	if findOTPInput(d) != nil {
+		return &LoginError{Reason: LoginWrongOTP, Message: findLoginMessage(d), Url: cu}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package univ
+
+import (
+	"time"
+)
+
+// FastestPlaybackRate is the rate set by startPlayer.
+const FastestPlaybackRate = 2
+
+// EstimateDuration estimates the time to watch the lectures at the fastest rate.
+// The time to solve quizzes is not included.
+func EstimateDuration(lectures []Lecture) time.Duration {
+	var total time.Duration
+	for _, l := range lectures {
+		total += l.RemainingPlayback()
+	}
+
+	return total / FastestPlaybackRate
+}
+
+// Plan is the subjects and the lectures found by Scan.
+// It is never modified after Scan, so it is safe to share.
+type Plan struct {
+	subjects []Subject
+}
+
+// Subjects returns a copy of the subjects in the page order.
+func (p *Plan) Subjects() []Subject {
+	subjects := make([]Subject, len(p.subjects))
+	for i, subject := range p.subjects {
+		subjects[i] = subject
+		subjects[i].Lectures = append([]Lecture(nil), subject.Lectures...)
+	}
+
+	return subjects
+}
+
+// Pending returns the lectures ready and not done yet, in the page order.
+func (p *Plan) Pending() []Lecture {
+	var lectures []Lecture
+	for _, subject := range p.subjects {
+		for _, lecture := range subject.Lectures {
+			if lecture.IsReadied && !lecture.IsDone() {
+				lectures = append(lectures, lecture)
+			}
+		}
+	}
+
+	return lectures
+}
@@ -2,62 +2,34 @@ package univ
 
 import (
 	"math/rand"
-	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/tebeka/selenium"
 
 	"github.com/Kcrong/autostudy/pkg/driver"
-	"github.com/Kcrong/autostudy/pkg/noti"
+	"github.com/Kcrong/autostudy/pkg/failure"
 )
 
-type WatchFuncType func(*Lecture) error
+// maxPlaybackTime is the longest a lecture can be played for, even if the playback keeps moving.
+const maxPlaybackTime = 3 * time.Hour
 
-func NewWatchFunc(wd selenium.WebDriver, url string, bot *noti.TelegramBot) WatchFuncType {
-	return func(l *Lecture) error {
-		if err := driver.AssertUrl(url, wd); err != nil {
-			return err
-		}
-
-		if err := l.ButtonElement.Click(); err != nil {
-			return errors.Wrap(err, "button.Click()")
-		}
-
-		_ = wd.Wait(func(wd selenium.WebDriver) (bool, error) {
-			handles, err := wd.WindowHandles()
-			if err != nil {
-				return false, errors.Wrap(err, "wd.CurrentWindowHandle()")
-			}
-			return len(handles) == 2, nil
-		})
-
-		handles, err := wd.WindowHandles()
-		if err != nil {
-			return errors.Wrap(err, "wd.CurrentWindowHandle()")
-		}
-		mainWindowHandle, lectureWindowHandle := handles[0], handles[1]
-
-		if err := wd.SwitchWindow(lectureWindowHandle); err != nil {
-			return errors.Wrap(err, "wd.SwitchWindow(lectureWindowHandle)")
-		}
-
-		if !l.HasPlayed {
-			if err := play(wd); err != nil {
-				return err
-			}
-		}
-		if l.HasExam {
-			if err := solveQuiz(wd); err != nil {
-				return err
-			}
-		}
+// watchLecture completes the content of the lecture in the lecture window, with the handler of its type.
+// The caller switches to the lecture window, and closes it afterwards.
+func watchLecture(wd selenium.WebDriver, auth *Auth, l Lecture, content ContentOption, watchdog Watchdog, playbackFunc PlaybackFuncType) error {
+	if expired, err := auth.isExpired(wd); err != nil {
+		return err
+	} else if expired {
+		return errors.Wrap(failure.ErrSessionExpired, "lecture window")
+	}
 
-		if err := bot.SendMessage("Completed lecture: " + l.Title); err != nil {
-			return err
-		}
-		return closeLectureWindow(wd, mainWindowHandle)
+	handler, ok := content.handler(l)
+	if !ok {
+		return unsupportedError(l)
 	}
+
+	return layoutError(handler(wd, l, watchdog, playbackFunc))
 }
 
 func solveQuiz(wd selenium.WebDriver) error {
@@ -133,7 +105,9 @@ func solveQuiz(wd selenium.WebDriver) error {
 				}
 			}
 
-			_ = wd.AcceptAlert()
+			if err := driver.HandleDialog(wd); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -149,7 +123,12 @@ func parseAnswers(formElement selenium.WebElement) ([]selenium.WebElement, error
 	return answerElement.FindElements(selenium.ByClassName, "lists")
 }
 
-func play(wd selenium.WebDriver) error {
+// PlaybackFuncType is called with the current location and the total duration while playing.
+type PlaybackFuncType func(current, total time.Duration)
+
+// play plays the video until its end. The watchdog recovers the playback if it stalls,
+// and returns a stalledError if the lecture window should be opened again.
+func play(wd selenium.WebDriver, l Lecture, watchdog Watchdog, playbackFunc PlaybackFuncType) error {
 	iframeElement, err := driver.WaitAndFindElement(wd, selenium.ByTagName, "iframe")
 	if err != nil {
 		return errors.Wrap(err, "wd.FindElement(selenium.ByID, \"ifrmVODPlayer_0\")")
@@ -159,160 +138,83 @@ func play(wd selenium.WebDriver) error {
 		return errors.Wrap(err, "wd.SwitchFrame(playerElement)")
 	}
 
-	if err := startPlayer(wd); err != nil {
-		return err
-	}
-
-	// NOTE: Even if fails to set the speed, ignore the error.
-	_ = setFastest(wd)
-
-	_ = driver.WaitElement(wd, selenium.ByXPATH, `//*[@id="wp-controls-outer-controlbar"]/div[2]/div[2]/div/div/div[3]/span`)
-
-	totalDuration, err := parsePlayerDuration(wd, `//*[@id="wp-controls-outer-controlbar"]/div[2]/div[2]/div/div/div[3]/span`)
+	player, err := waitPlayer(wd)
 	if err != nil {
 		return err
 	}
 
-	if err := wd.WaitWithTimeoutAndInterval(func(wd selenium.WebDriver) (bool, error) {
-		// NOTE: Sometimes the player is playing, but the current location is not available.
-		currentLocation, _ := parsePlayerDuration(wd, `//*[@id="wp-controls-outer-controlbar"]/div[2]/div[2]/div/div/div[1]/span`)
-		return totalDuration.Equal(currentLocation), nil
-	}, 3*time.Hour, time.Minute); err != nil {
+	if err := startPlayer(wd, player); err != nil {
 		return err
 	}
 
-	return wd.SwitchFrame(nil)
-}
-
-func closeLectureWindow(wd selenium.WebDriver, mainWindowHandle string) error {
-	if err := wd.Close(); err != nil {
-		return errors.Wrap(err, "wd.Close()")
-	}
-
-	return wd.SwitchWindow(mainWindowHandle)
-}
-
-func parsePlayerDuration(wd selenium.WebDriver, xpath string) (time.Time, error) {
-	if err := mouseOverToPlayer(wd); err != nil {
-		return time.Time{}, err
-	}
-
-	de, err := driver.WaitAndFindElement(wd, selenium.ByXPATH, xpath)
-	if err != nil {
-		return time.Time{}, errors.Wrap(err, "driver.WaitAndFindElement(wd, selenium.ByXPATH, xpath)")
-	}
-
-	text, err := de.Text()
-	if err != nil {
-		return time.Time{}, errors.Wrap(err, "de.Text()")
-	}
-
-	return parseDuration(text)
-}
-
-func parseDuration(duration string) (time.Time, error) {
-	withHour, err := time.Parse("15:04:05", duration)
-	if err == nil {
-		return withHour, nil
-	}
-
-	withoutHour, err := time.Parse("04:05", duration)
-	if err == nil {
-		return withoutHour, nil
-	}
-
-	return time.Time{}, errors.Errorf("parseDuration: invalid duration: %s", duration)
-}
-
-func mouseOverToPlayer(wd selenium.WebDriver) error {
-	playerElement, err := wd.FindElement(selenium.ByID, "player0")
-	if err != nil {
-		return errors.Wrap(err, "wd.FindElement(selenium.ByID, \"player0\")")
-	}
-	if err := playerElement.MoveTo(10, 10); err != nil {
-		return errors.Wrap(err, "playerElement.MoveTo(0,0)")
-	}
+	var (
+		deadline = time.Now().Add(maxPlaybackTime)
+		location time.Duration
+		movedAt  = time.Now()
+		step     = RecoveryResume
+	)
+	for {
+		state, err := player.State()
+		if err == nil {
+			playbackFunc(state.Current, state.Duration)
+			if state.IsEnded() {
+				break
+			}
 
-	return nil
-}
+			if state.Current != location {
+				location, movedAt, step = state.Current, time.Now(), RecoveryResume
+			}
+		}
 
-func setFastest(wd selenium.WebDriver) error {
-	if err := mouseOverToPlayer(wd); err != nil {
-		return err
-	}
+		if time.Now().After(deadline) {
+			return failure.Wrap(errors.Errorf("playback did not end in %s", maxPlaybackTime), failure.ErrPlayerTimeout)
+		}
 
-	speedTitleElement, err := wd.FindElement(selenium.ByID, "currentSpeedTitle")
-	if err != nil {
-		return errors.Wrap(err, "wd.FindElement(selenium.ByID, \"currentSpeedTitle\")")
-	}
-	if err := speedTitleElement.Click(); err != nil {
-		return errors.Wrap(err, "speedTitleElement.Click()")
-	}
+		if watchdog.isStalled(movedAt) {
+			if step == RecoveryReopen {
+				return &stalledError{location: location}
+			}
 
-	fastestSpeedElement, err := wd.FindElement(selenium.ByID, "opSpeed_20")
-	if err != nil {
-		return errors.Wrap(err, "wd.FindElement(selenium.ByID, \"opSpeed_20\")")
-	}
+			watchdog.report(l, step, location)
+			if err := recoverPlayback(wd, player, step); err != nil {
+				// NOTE: The next step is tried if the playback is still stalled.
+				log.Warnf("failed to %s the playback of %s: %+v", step, l.Title, err)
+			}
+			step++
+			movedAt = time.Now()
+		}
 
-	if err := wd.Wait(func(wd selenium.WebDriver) (bool, error) {
-		return fastestSpeedElement.IsDisplayed()
-	}); err != nil {
-		return err
+		time.Sleep(watchdog.pollInterval())
 	}
 
-	return fastestSpeedElement.Click()
+	return wd.SwitchFrame(nil)
 }
 
-func startPlayer(wd selenium.WebDriver) error {
-	playButton, err := driver.WaitAndFindElement(wd, selenium.ByXPATH, `//*[@id="player0"]/div[6]/div[1]/div`)
-	if err != nil {
-		return errors.Wrap(err, "wd.FindElement(selenium.ByXPATH, `//*[@id=\"player0\"]/div[6]/div[1]/div`)")
-	}
-	if err := playButton.Click(); err != nil {
-		return errors.Wrap(err, "playButton.Click()")
-	}
-
-	return wd.WaitWithTimeoutAndInterval(func(wd selenium.WebDriver) (bool, error) {
-		playerElement, err := wd.FindElement(selenium.ByID, "player0")
-		if err != nil {
-			return false, errors.Wrap(err, "wd.FindElement(selenium.ByID, \"player0\")")
-		}
+// startPlayer starts the playback at FastestPlaybackRate, and waits for it to go on.
+// The continue button of the LMS is clicked first, to continue from the last location.
+func startPlayer(wd selenium.WebDriver, player Player) error {
+	if err := wd.WaitWithTimeoutAndInterval(func(wd selenium.WebDriver) (bool, error) {
 		if err := clickContinue(wd); err != nil {
 			return false, errors.Wrap(err, "clickContinue()")
 		}
 
-		return getStatus(playerElement) == PlayerStatusPlaying, nil
-	}, time.Minute, 2*time.Second)
-}
-
-type PlayerStatus int
-
-const (
-	PlayerStatusUnknown PlayerStatus = iota
-	PlayerStatusIdle
-	PlayerStatusPending
-	PlayerStatusPlaying
-)
-
-func getStatus(playerElement selenium.WebElement) PlayerStatus {
-	playerElementClass, err := playerElement.GetAttribute("class")
-	if err != nil {
-		return 0
-	}
-
-	if strings.Contains(playerElementClass, "jw-state-idle") {
-		return PlayerStatusIdle
-	}
+		state, err := player.State()
+		if err != nil {
+			return false, nil
+		}
+		if state.IsPlaying() || state.IsEnded() {
+			return true, nil
+		}
 
-	if strings.Contains(playerElementClass, "jw-state-paused") {
-		return PlayerStatusPending
+		return false, player.Play()
+	}, time.Minute, 2*time.Second); err != nil {
+		return failure.Wrap(errors.Wrap(err, "wait for the player to start"), failure.ErrPlayerTimeout)
 	}
 
-	if strings.Contains(playerElementClass, "jw-state-playing") {
-		return PlayerStatusPlaying
-	}
+	// NOTE: Even if fails to set the speed, ignore the error.
+	_ = player.SetRate(FastestPlaybackRate)
 
-	return PlayerStatusUnknown
+	return nil
 }
 
 func clickContinue(wd selenium.WebDriver) error {
@@ -0,0 +1,166 @@
+package univ
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/failure"
+)
+
+// PlayerState is the state of a player, read through JavaScript.
+type PlayerState struct {
+	Current  time.Duration
+	Duration time.Duration
+	Paused   bool
+	Ended    bool
+}
+
+// IsPlaying reports whether the playback is going on.
+func (s PlayerState) IsPlaying() bool {
+	return !s.Paused && !s.Ended
+}
+
+// IsEnded reports whether the playback has reached the end.
+func (s PlayerState) IsEnded() bool {
+	return s.Ended || (s.Duration > 0 && s.Current >= s.Duration)
+}
+
+// Player controls the video player of the frame the driver is switched to.
+type Player interface {
+	State() (PlayerState, error)
+	Play() error
+	SetRate(rate float64) error
+}
+
+// detectPlayer returns the Player for the player in the current frame.
+// JW Player is preferred, since it wraps its own video element.
+func detectPlayer(wd selenium.WebDriver) (Player, error) {
+	kind, err := wd.ExecuteScript(`
+		if (typeof jwplayer === "function" && jwplayer().getState) {
+			return "jwplayer";
+		}
+		if (document.querySelector("video")) {
+			return "html5";
+		}
+		return "";
+	`, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "wd.ExecuteScript(detect player)")
+	}
+
+	switch kind {
+	case "jwplayer":
+		return &jwPlayer{wd: wd}, nil
+	case "html5":
+		return &html5Player{wd: wd}, nil
+	default:
+		return nil, errors.New("detectPlayer: no player in the frame")
+	}
+}
+
+// waitPlayer waits for a player to appear in the current frame.
+func waitPlayer(wd selenium.WebDriver) (Player, error) {
+	var player Player
+	if err := wd.WaitWithTimeoutAndInterval(func(wd selenium.WebDriver) (bool, error) {
+		p, err := detectPlayer(wd)
+		if err != nil {
+			return false, nil
+		}
+		player = p
+		return true, nil
+	}, time.Minute, 2*time.Second); err != nil {
+		p, err := detectPlayer(wd)
+		if err != nil {
+			return nil, failure.Wrap(errors.Wrap(err, "wait for the player"), failure.ErrPlayerTimeout)
+		}
+		return p, nil
+	}
+
+	return player, nil
+}
+
+type jwPlayer struct {
+	wd selenium.WebDriver
+}
+
+func (p *jwPlayer) State() (PlayerState, error) {
+	// NOTE: The state of JW Player is one of idle, buffering, playing, paused and complete.
+	v, err := p.wd.ExecuteScript(`
+		var p = jwplayer();
+		var state = p.getState();
+		return {current: p.getPosition(), duration: p.getDuration(), paused: state !== "playing" && state !== "buffering", ended: state === "complete"};
+	`, nil)
+	if err != nil {
+		return PlayerState{}, errors.Wrap(err, "wd.ExecuteScript(jwplayer state)")
+	}
+
+	return parsePlayerState(v)
+}
+
+func (p *jwPlayer) Play() error {
+	_, err := p.wd.ExecuteScript(`jwplayer().play();`, nil)
+	return errors.Wrap(err, "wd.ExecuteScript(jwplayer play)")
+}
+
+func (p *jwPlayer) SetRate(rate float64) error {
+	_, err := p.wd.ExecuteScript(`jwplayer().setPlaybackRate(arguments[0]);`, []interface{}{rate})
+	return errors.Wrap(err, "wd.ExecuteScript(jwplayer setPlaybackRate)")
+}
+
+type html5Player struct {
+	wd selenium.WebDriver
+}
+
+func (p *html5Player) State() (PlayerState, error) {
+	v, err := p.wd.ExecuteScript(`
+		var v = document.querySelector("video");
+		return {current: v.currentTime, duration: v.duration, paused: v.paused, ended: v.ended};
+	`, nil)
+	if err != nil {
+		return PlayerState{}, errors.Wrap(err, "wd.ExecuteScript(video state)")
+	}
+
+	return parsePlayerState(v)
+}
+
+func (p *html5Player) Play() error {
+	// NOTE: play returns a promise, which is not waited for. The state tells whether it is playing.
+	_, err := p.wd.ExecuteScript(`document.querySelector("video").play();`, nil)
+	return errors.Wrap(err, "wd.ExecuteScript(video play)")
+}
+
+func (p *html5Player) SetRate(rate float64) error {
+	_, err := p.wd.ExecuteScript(`document.querySelector("video").playbackRate = arguments[0];`, []interface{}{rate})
+	return errors.Wrap(err, "wd.ExecuteScript(video playbackRate)")
+}
+
+// parsePlayerState parses the object returned by the scripts of the players.
+// NOTE: The duration is NaN, returned as null, until the metadata of the video is loaded.
+func parsePlayerState(v interface{}) (PlayerState, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return PlayerState{}, errors.Errorf("parsePlayerState: unexpected state: %v", v)
+	}
+
+	paused, _ := m["paused"].(bool)
+	ended, _ := m["ended"].(bool)
+
+	return PlayerState{
+		Current:  secondsToDuration(m["current"]),
+		Duration: secondsToDuration(m["duration"]),
+		Paused:   paused,
+		Ended:    ended,
+	}, nil
+}
+
+func secondsToDuration(v interface{}) time.Duration {
+	seconds, ok := v.(float64)
+	if !ok || math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -7,13 +7,15 @@ import (
 	"github.com/tebeka/selenium"
 
 	"github.com/Kcrong/autostudy/pkg/driver"
+	"github.com/Kcrong/autostudy/pkg/failure"
 )
 
 type Subject struct {
-	Title        string
-	Progress     float32
-	Lectures     []*Lecture
-	ExpandButton selenium.WebElement
+	// ID is the position of the subject in the lecture page.
+	ID       int
+	Title    string
+	Progress float32
+	Lectures []Lecture
 }
 
 func (s Subject) IsCompleted() bool {
@@ -26,29 +28,45 @@ func (s Subject) IsCompleted() bool {
 	return true
 }
 
-type GetSubjectsOption struct {
-	WithLectures bool
-	WatchFunc    WatchFuncType
+// Scan parses the subjects and their lectures of the lecture page without watching anything.
+func Scan(url string, wd selenium.WebDriver, auth *Auth) (*Plan, error) {
+	subjectElements, err := findSubjectElements(url, wd, auth)
+	if err != nil {
+		return nil, layoutError(err)
+	}
+
+	subjects := make([]Subject, len(subjectElements))
+	for i, subjectElement := range subjectElements {
+		sj, err := parseSubjectElement(wd, i, subjectElement)
+		if err != nil {
+			return nil, layoutError(err)
+		}
+		subjects[i] = sj
+	}
+
+	return &Plan{subjects: subjects}, nil
 }
 
-func GetSubjects(url string, wd selenium.WebDriver, withLectures bool, watchFunc WatchFuncType) ([]*Subject, error) {
-	element, err := getSubjectElement(url, wd)
-	if err != nil {
-		return nil, err
+// layoutError classifies the error of an element missing in a page as failure.ErrLayoutChanged.
+// Other errors, such as timeouts, are left as they are, so that the lecture is retried instead of stopping the run.
+func layoutError(err error) error {
+	if !driver.IsNoSuchElementError(err) {
+		return err
 	}
 
-	return parseSubjects(element, withLectures, watchFunc)
+	return failure.Wrap(err, failure.ErrLayoutChanged)
 }
 
-func getSubjectElement(url string, wd selenium.WebDriver) (selenium.WebElement, error) {
-	if err := driver.AssertUrl(url, wd); err != nil {
+func findSubjectElements(url string, wd selenium.WebDriver, auth *Auth) ([]selenium.WebElement, error) {
+	if err := auth.navigate(wd, url); err != nil {
 		return nil, err
 	}
 
-	return wd.ActiveElement()
-}
+	element, err := wd.ActiveElement()
+	if err != nil {
+		return nil, errors.Wrap(err, "wd.ActiveElement()")
+	}
 
-func parseSubjects(element selenium.WebElement, parseLectures bool, watchFunc WatchFuncType) ([]*Subject, error) {
 	progressElement, err := element.FindElement(selenium.ByClassName, "lecture-progress")
 	if err != nil {
 		return nil, errors.Wrap(err, "element.FindElement(lecture-progress)")
@@ -59,67 +77,95 @@ func parseSubjects(element selenium.WebElement, parseLectures bool, watchFunc Wa
 		return nil, errors.Wrap(err, "progress.FindElements(lecture-progress-item)")
 	}
 
-	subjects := make([]*Subject, len(subjectElements))
-	for i, subjectElement := range subjectElements {
-		sj, err := parseSubjectElement(subjectElement, parseLectures, watchFunc)
+	return subjectElements, nil
+}
+
+func parseSubjectElement(wd selenium.WebDriver, id int, subjectElement selenium.WebElement) (Subject, error) {
+	infoElement, err := subjectElement.FindElement(selenium.ByClassName, "lecture-info")
+	if err != nil {
+		return Subject{}, errors.Wrap(err, "subjectElement.FindElement(lecture-info)")
+	}
+
+	progress, err := extractProgress(infoElement)
+	if err != nil {
+		return Subject{}, err
+	}
+
+	titleText, err := extractSubjectTitle(subjectElement)
+	if err != nil {
+		return Subject{}, err
+	}
+
+	lectureElements, err := expandLectureElements(wd, subjectElement)
+	if err != nil {
+		return Subject{}, err
+	}
+
+	lectures := make([]Lecture, len(lectureElements))
+	for i, element := range lectureElements {
+		lectures[i], err = ParseLecture(titleText, element)
 		if err != nil {
-			return nil, err
+			return Subject{}, err
 		}
-		subjects[i] = sj
+		lectures[i].position = lecturePosition{subject: id, lecture: i}
 	}
 
-	return subjects, nil
+	return Subject{
+		ID:       id,
+		Title:    titleText,
+		Progress: progress,
+		Lectures: lectures,
+	}, nil
 }
 
-func parseSubjectElement(subjectElement selenium.WebElement, parseLecture bool, watchFunc WatchFuncType) (*Subject, error) {
+func findToggleButton(subjectElement selenium.WebElement) (selenium.WebElement, error) {
 	infoElement, err := subjectElement.FindElement(selenium.ByClassName, "lecture-info")
 	if err != nil {
 		return nil, errors.Wrap(err, "subjectElement.FindElement(lecture-info)")
 	}
 
-	progress, err := extractProgress(infoElement)
+	buttonElement, err := infoElement.FindElement(selenium.ByClassName, "btn-toggle")
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "infoElement.FindElement(btn-toggle)")
 	}
 
-	buttonElement, err := infoElement.FindElement(selenium.ByClassName, "btn-toggle")
+	return buttonElement, nil
+}
+
+func extractSubjectTitle(subjectElement selenium.WebElement) (string, error) {
+	buttonElement, err := findToggleButton(subjectElement)
 	if err != nil {
-		return nil, errors.Wrap(err, "infoElement.FindElement(btn-toggle)")
+		return "", err
 	}
 
 	titleText, err := buttonElement.Text()
 	if err != nil {
-		return nil, errors.Wrap(err, "buttonElement.Text()")
+		return "", errors.Wrap(err, "buttonElement.Text()")
 	}
 
-	var lectures []*Lecture
-	if parseLecture {
-		// Click the button to expand the lecture list.
-		if err := buttonElement.Click(); err != nil {
-			return nil, errors.Wrap(err, "buttonElement.Click()")
-		}
+	return titleText, nil
+}
 
-		// Extract lecture web elements
-		lectureElements, err := extractLectureElements(subjectElement)
-		if err != nil {
-			return nil, err
+// expandLectureElements expands the lecture list of the subject unless it is already expanded.
+// NOTE: The toggle button collapses the expanded list, so it must not be clicked blindly.
+func expandLectureElements(wd selenium.WebDriver, subjectElement selenium.WebElement) ([]selenium.WebElement, error) {
+	body, err := subjectElement.FindElement(selenium.ByClassName, "lecture-progress-item-body")
+	if err == nil {
+		if displayed, err := body.IsDisplayed(); err == nil && displayed {
+			return extractLectureElements(subjectElement)
 		}
+	}
 
-		lectures = make([]*Lecture, len(lectureElements))
-		for i, element := range lectureElements {
-			lectures[i], err = ParseLecture(element, watchFunc)
-			if err != nil {
-				return nil, err
-			}
-		}
+	if err := driver.Click(wd, driver.Locator{
+		Name: "subject toggle",
+		Find: func(selenium.WebDriver) (selenium.WebElement, error) {
+			return findToggleButton(subjectElement)
+		},
+	}); err != nil {
+		return nil, err
 	}
 
-	return &Subject{
-		Title:        titleText,
-		Progress:     progress,
-		Lectures:     lectures,
-		ExpandButton: buttonElement,
-	}, nil
+	return extractLectureElements(subjectElement)
 }
 
 func extractLectureElements(subjectElement selenium.WebElement) ([]selenium.WebElement, error) {
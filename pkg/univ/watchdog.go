@@ -0,0 +1,126 @@
+package univ
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tebeka/selenium"
+
+	"github.com/Kcrong/autostudy/pkg/driver"
+)
+
+// RecoveryStep is a step to recover a stalled playback. The steps are tried in order, until the playback moves again.
+type RecoveryStep int
+
+const (
+	// RecoveryResume clicks the continue or the play button of the player.
+	RecoveryResume RecoveryStep = iota
+	// RecoveryReloadFrame reloads the frame of the player.
+	RecoveryReloadFrame
+	// RecoveryReopen closes the lecture window, and opens the lecture again. The LMS continues it from the last location.
+	RecoveryReopen
+)
+
+func (s RecoveryStep) String() string {
+	switch s {
+	case RecoveryResume:
+		return "resume"
+	case RecoveryReloadFrame:
+		return "reload frame"
+	case RecoveryReopen:
+		return "reopen lecture"
+	default:
+		return "unknown"
+	}
+}
+
+// RecoveryFuncType is called before the step is tried for the playback of the lecture stalled at location.
+type RecoveryFuncType func(l Lecture, step RecoveryStep, location time.Duration)
+
+// Watchdog reads the playback location every PollInterval, and recovers the playback if it stays still for StallTimeout.
+// Stalls are not detected if StallTimeout is zero.
+type Watchdog struct {
+	PollInterval time.Duration
+	StallTimeout time.Duration
+	RecoveryFunc RecoveryFuncType
+}
+
+func (w Watchdog) pollInterval() time.Duration {
+	if w.PollInterval <= 0 {
+		return time.Minute
+	}
+
+	return w.PollInterval
+}
+
+func (w Watchdog) isStalled(movedAt time.Time) bool {
+	return w.StallTimeout > 0 && time.Since(movedAt) >= w.StallTimeout
+}
+
+func (w Watchdog) report(l Lecture, step RecoveryStep, location time.Duration) {
+	log.Warnf("playback of %s stalled at %s, try to %s", l.Title, location, step)
+	if w.RecoveryFunc != nil {
+		w.RecoveryFunc(l, step, location)
+	}
+}
+
+// stalledError is returned by play when the playback could not be recovered in the lecture window.
+type stalledError struct {
+	location time.Duration
+}
+
+func (e *stalledError) Error() string {
+	return "playback stalled at " + e.location.String()
+}
+
+// recoverPlayback tries the step on the player. It is switched to the player frame on return.
+func recoverPlayback(wd selenium.WebDriver, player Player, step RecoveryStep) error {
+	switch step {
+	case RecoveryResume:
+		return resumePlayer(wd, player)
+	case RecoveryReloadFrame:
+		return reloadPlayerFrame(wd, player)
+	default:
+		return errors.Errorf("recoverPlayback: unsupported step: %s", step)
+	}
+}
+
+// resumePlayer clicks the continue button, then plays the player if it is still not playing.
+func resumePlayer(wd selenium.WebDriver, player Player) error {
+	if err := clickContinue(wd); err != nil {
+		return errors.Wrap(err, "clickContinue()")
+	}
+
+	state, err := player.State()
+	if err != nil {
+		return err
+	}
+	if state.IsPlaying() {
+		return nil
+	}
+
+	return player.Play()
+}
+
+func reloadPlayerFrame(wd selenium.WebDriver, player Player) error {
+	if err := wd.SwitchFrame(nil); err != nil {
+		return errors.Wrap(err, "wd.SwitchFrame(nil)")
+	}
+
+	iframeElement, err := driver.WaitAndFindElement(wd, selenium.ByTagName, "iframe")
+	if err != nil {
+		return err
+	}
+
+	if _, err := wd.ExecuteScript("arguments[0].src = arguments[0].src;", []interface{}{iframeElement}); err != nil {
+		return errors.Wrap(err, "wd.ExecuteScript(reload iframe)")
+	}
+
+	if err := wd.SwitchFrame(iframeElement); err != nil {
+		return errors.Wrap(err, "wd.SwitchFrame(iframeElement)")
+	}
+
+	// NOTE: The player reads the page of the frame on each call, so it works for the reloaded one.
+	return startPlayer(wd, player)
+}